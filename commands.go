@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/e2e"
+)
+
+// command is a subcommand of the pastytext binary.
+type command func(args []string, stdin io.Reader, stdout io.Writer) error
+
+// commands maps subcommand names to their implementation.
+// Running pastytext without a subcommand starts the server.
+var commands = map[string]command{
+	"encrypt":    encryptCommand,
+	"decrypt":    decryptCommand,
+	"keygen":     keygenCommand,
+	"rotate-key": rotateKeyCommand,
+	"export":     exportCommand,
+	"import":     importCommand,
+	"backup":     backupCommand,
+	"restore":    restoreCommand,
+}
+
+// runCommand runs the named subcommand.
+func runCommand(name string, args []string, stdin io.Reader, stdout io.Writer) error {
+	cmd, ok := commands[name]
+	if !ok {
+		var names []string
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+	return cmd(args, stdin, stdout)
+}
+
+// encryptCommand reads text from stdin and prints it as an end-to-end encrypted
+// envelope that can be sent as a paste with encryption "e2e-v1".
+func encryptCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	key, err := roomKey("encrypt", args)
+	if err != nil {
+		return err
+	}
+
+	text, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+
+	envelope, err := key.Seal(string(text))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, envelope)
+	return err
+}
+
+// decryptCommand reads an end-to-end encrypted envelope from stdin and prints the text.
+func decryptCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	key, err := roomKey("decrypt", args)
+	if err != nil {
+		return err
+	}
+
+	envelope, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+
+	text, err := key.Open(strings.TrimSpace(string(envelope)))
+	if err != nil {
+		return fmt.Errorf("cannot decrypt, wrong room secret or corrupted paste: %w", err)
+	}
+	_, err = io.WriteString(stdout, text)
+	return err
+}
+
+// roomKey derives the key from the -secret flag or the PASTYTEXT_SECRET environment variable.
+func roomKey(name string, args []string) (*e2e.Key, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	secret := fs.String("secret", os.Getenv("PASTYTEXT_SECRET"), "room secret (defaults to $PASTYTEXT_SECRET)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *secret == "" {
+		return nil, errors.New("a room secret is required, use -secret or PASTYTEXT_SECRET")
+	}
+	return e2e.DeriveKey(*secret)
+}
+
+// keygenCommand prints a new random key for DB_KEY or DB_KEY_FILE.
+func keygenCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	key, err := data.GenerateKey()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, key)
+	return err
+}
+
+// rotateKeyCommand re-encrypts the database in DB_FILE with a new key. The current key is
+// read from DB_KEY or DB_KEY_FILE as when starting the server, which must not be running.
+// A database that was not encrypted before is encrypted with the new key.
+func rotateKeyCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	newKeyFile := fs.String("new-key-file", "", "file holding the new key, as printed by keygen")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *newKeyFile == "" {
+		return errors.New("-new-key-file is required")
+	}
+
+	master, err := data.ReadKeyFile(*newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	dbm, err := data.NewManager()
+	if err != nil {
+		return err
+	}
+	defer dbm.Close()
+
+	if err := dbm.RotateKey(master); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "database re-encrypted, start the server with the key in %s from now on\n", *newKeyFile)
+	return err
+}
+
+// exportCommand prints the pastes of a network of the database in DB_FILE in one of the
+// export formats.
+func exportCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	network := fs.String("network", "", "network whose pastes are exported")
+	format := fs.String("format", data.FormatJSON, "export format: "+strings.Join(data.Formats, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *network == "" {
+		return errors.New("-network is required")
+	}
+
+	dbm, err := data.NewManager()
+	if err != nil {
+		return err
+	}
+	defer dbm.Close()
+
+	return dbm.Export(stdout, *network, *format)
+}
+
+// importCommand adds the pastes of an export, read from the file given as argument or
+// from stdin, to a network of the database in DB_FILE. The format is guessed when it is
+// not given.
+func importCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	network := fs.String("network", "", "network the pastes are added to")
+	format := fs.String("format", "", "export format: "+strings.Join(data.Formats, ", ")+" (guessed by default)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *network == "" {
+		return errors.New("-network is required")
+	}
+
+	var b []byte
+	var err error
+	if fs.NArg() > 0 {
+		b, err = os.ReadFile(fs.Arg(0))
+	} else {
+		b, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = data.DetectFormat(b)
+	}
+
+	dbm, err := data.NewManager()
+	if err != nil {
+		return err
+	}
+	defer dbm.Close()
+
+	n, err := dbm.Import(b, *network, *format, nil)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "imported %d pastes into %s\n", n, *network)
+	return err
+}
+
+// backupCommand writes a consistent snapshot of the database in DB_FILE to a file. The
+// database is only read, so it is safe to run while the server is running.
+func backupCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "file the backup is written to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	if err := data.BackupFile(*out); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(stdout, "database backed up to %s\n", *out)
+	return err
+}
+
+// restoreCommand replaces the database in DB_FILE with the backup given as argument,
+// after checking that this version of PastyText can open it. The server must not be
+// running.
+func restoreCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected the backup file as argument")
+	}
+
+	if err := data.Restore(fs.Arg(0)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(stdout, "database restored from %s\n", fs.Arg(0))
+	return err
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestEncryptDecryptCommands(t *testing.T) {
+	var envelope bytes.Buffer
+	err := runCommand("encrypt", []string{"-secret", "correct horse"}, strings.NewReader("hello world!"), &envelope)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if strings.Contains(envelope.String(), "hello") {
+		t.Errorf("Expected ciphertext, got %v", envelope.String())
+	}
+
+	t.Setenv("PASTYTEXT_SECRET", "correct horse")
+	var text bytes.Buffer
+	if err := runCommand("decrypt", nil, &envelope, &text); err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if text.String() != "hello world!" {
+		t.Errorf("Expected 'hello world!', got %v", text.String())
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if err := runCommand("frobnicate", nil, nil, nil); err == nil {
+		t.Errorf("Expected an error for an unknown command")
+	}
+}
+
+func TestRotateKeyCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DB_FILE", filepath.Join(dir, "pastytext.db"))
+
+	var oldKey bytes.Buffer
+	if err := runCommand("keygen", nil, nil, &oldKey); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	t.Setenv("DB_KEY", strings.TrimSpace(oldKey.String()))
+
+	dbm, err := data.NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	dbm.InsertPaste(data.Paste{Network: "test-network", Content: "secret stuff"})
+	dbm.Close()
+
+	var newKey bytes.Buffer
+	runCommand("keygen", nil, nil, &newKey)
+	keyFile := filepath.Join(dir, "new.key")
+	os.WriteFile(keyFile, newKey.Bytes(), 0600)
+
+	var out bytes.Buffer
+	if err := runCommand("rotate-key", []string{"-new-key-file", keyFile}, nil, &out); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+
+	t.Setenv("DB_KEY", "")
+	t.Setenv("DB_KEY_FILE", keyFile)
+	dbm, err = data.NewManager()
+	if err != nil {
+		t.Fatalf("Failed to open database with new key: %v", err)
+	}
+	defer dbm.Close()
+
+	pastes, _ := dbm.GetPastes("test-network")
+	if len(pastes) != 1 || pastes[0].Content != "secret stuff" {
+		t.Errorf("Expected paste to be readable with the new key, got %v", pastes)
+	}
+}
+
+func TestExportImportCommands(t *testing.T) {
+	t.Setenv("DB_FILE", filepath.Join(t.TempDir(), "pastytext.db"))
+
+	dbm, err := data.NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	dbm.InsertPaste(data.Paste{Network: "home", User: "alice", Device: "laptop", Content: "shopping list"})
+	dbm.Close()
+
+	var export bytes.Buffer
+	if err := runCommand("export", []string{"-network", "home", "-format", "ndjson"}, nil, &export); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runCommand("import", []string{"-network", "office"}, &export, &out); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if !strings.Contains(out.String(), "imported 1 pastes") {
+		t.Errorf("Unexpected import output %q", out.String())
+	}
+
+	if err := runCommand("import", nil, strings.NewReader("[]"), &out); err == nil {
+		t.Error("Expected import without -network to fail")
+	}
+
+	dbm, _ = data.NewManager()
+	defer dbm.Close()
+	pastes, _ := dbm.GetPastes("office")
+	if len(pastes) != 1 || pastes[0].Content != "shopping list" || pastes[0].Device != "laptop" {
+		t.Errorf("Expected the paste to be imported with its device, got %v", pastes)
+	}
+}
+
+func TestBackupRestoreCommands(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DB_FILE", filepath.Join(dir, "pastytext.db"))
+
+	dbm, err := data.NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	dbm.InsertPaste(data.Paste{Network: "home", Content: "keep me"})
+
+	var out bytes.Buffer
+	if err := runCommand("backup", nil, nil, &out); err == nil {
+		t.Error("Expected backup without -out to fail")
+	}
+	backup := filepath.Join(dir, "backup.db")
+	if err := runCommand("backup", []string{"--out", backup}, nil, &out); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	dbm.InsertPaste(data.Paste{Network: "home", Content: "lost"})
+	dbm.Close()
+
+	if err := runCommand("restore", []string{filepath.Join(dir, "missing.db")}, nil, &out); err == nil {
+		t.Error("Expected restore of a missing backup to fail")
+	}
+	if err := runCommand("restore", []string{backup}, nil, &out); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	dbm, _ = data.NewManager()
+	defer dbm.Close()
+	pastes, _ := dbm.GetPastes("home")
+	if len(pastes) != 1 || pastes[0].Content != "keep me" {
+		t.Errorf("Expected the database of the backup, got %v", pastes)
+	}
+}
+
+func TestBackupCommandLeavesDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "pastytext.db")
+	t.Setenv("DB_FILE", dbFile)
+
+	// A database of another program stands in for one of an older version
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE other (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runCommand("backup", []string{"--out", filepath.Join(dir, "backup.db")}, nil, &out); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	var tables int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables)
+	if tables != 1 {
+		t.Errorf("Expected the backed up database not to be migrated, got %v tables", tables)
+	}
+
+	t.Setenv("DB_FILE", filepath.Join(dir, "missing.db"))
+	if err := runCommand("backup", []string{"--out", filepath.Join(dir, "none.db")}, nil, &out); err == nil {
+		t.Error("Expected backup of a missing database to fail")
+	}
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// createPassphrases is a SQL query that creates the table holding network passphrase hashes.
+const createPassphrases = `CREATE TABLE IF NOT EXISTS network_passphrases (
+	network TEXT NOT NULL PRIMARY KEY,
+	hash TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);`
+
+// SetPassphrase protects the network with the passphrase, replacing any previous one.
+// Only a bcrypt hash of the passphrase is stored.
+func (m *Manager) SetPassphrase(network, passphrase string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.db.Exec(`INSERT INTO network_passphrases (network, hash, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(network) DO UPDATE SET hash = excluded.hash, created_at = excluded.created_at`,
+		network, string(hash), time.Now())
+	return err
+}
+
+// CheckPassphrase reports whether the passphrase matches the one protecting the network.
+// It returns false if the network is not protected.
+func (m *Manager) CheckPassphrase(network, passphrase string) (bool, error) {
+	var hash string
+	err := m.db.QueryRow("SELECT hash FROM network_passphrases WHERE network = ?", network).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(passphrase))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ProtectedSince returns when the network passphrase was last set,
+// or the zero time if the network is not protected.
+func (m *Manager) ProtectedSince(network string) (time.Time, error) {
+	var t time.Time
+	err := m.db.QueryRow("SELECT created_at FROM network_passphrases WHERE network = ?", network).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return t, err
+}
+
+// RemovePassphrase removes the protection from the network.
+func (m *Manager) RemovePassphrase(network string) error {
+	_, err := m.db.Exec("DELETE FROM network_passphrases WHERE network = ?", network)
+	return err
+}
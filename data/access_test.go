@@ -0,0 +1,54 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPassphrase(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	since, err := manager.ProtectedSince("test-network")
+	if err != nil || !since.IsZero() {
+		t.Errorf("Expected new network to be unprotected, got %v %v", since, err)
+	}
+
+	if err := manager.SetPassphrase("test-network", "correct horse"); err != nil {
+		t.Fatalf("Failed to set passphrase: %v", err)
+	}
+
+	var hash string
+	manager.db.QueryRow("SELECT hash FROM network_passphrases WHERE network = ?", "test-network").Scan(&hash)
+	if strings.Contains(hash, "correct horse") || !strings.HasPrefix(hash, "$2") {
+		t.Errorf("Expected passphrase to be stored as a bcrypt hash, got %v", hash)
+	}
+
+	if ok, err := manager.CheckPassphrase("test-network", "correct horse"); !ok || err != nil {
+		t.Errorf("Expected passphrase to match, got %v %v", ok, err)
+	}
+	if ok, _ := manager.CheckPassphrase("test-network", "wrong horse"); ok {
+		t.Errorf("Expected wrong passphrase not to match")
+	}
+	if ok, _ := manager.CheckPassphrase("other-network", "correct horse"); ok {
+		t.Errorf("Expected passphrase not to match on another network")
+	}
+
+	since, _ = manager.ProtectedSince("test-network")
+	if since.IsZero() {
+		t.Errorf("Expected network to be protected")
+	}
+
+	if err := manager.RemovePassphrase("test-network"); err != nil {
+		t.Errorf("Failed to remove passphrase: %v", err)
+	}
+	if ok, _ := manager.CheckPassphrase("test-network", "correct horse"); ok {
+		t.Errorf("Expected removed passphrase not to match")
+	}
+}
@@ -0,0 +1,145 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// createBans is a SQL query that creates the table of banned addresses.
+const createBans = `CREATE TABLE IF NOT EXISTS bans (
+	id INTEGER NOT NULL PRIMARY KEY,
+	cidr TEXT NOT NULL,
+	reason TEXT,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME
+);`
+
+// NetworkStat summarizes the pastes stored for a network.
+type NetworkStat struct {
+	Network   string
+	Pastes    int
+	Bytes     int64
+	LastPaste time.Time
+	Protected bool
+}
+
+// Ban is a banned IP address or CIDR range.
+type Ban struct {
+	Id        int64
+	CIDR      string
+	Reason    string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+// NetworkStats returns the paste count and size of every network that has pastes.
+func (m *Manager) NetworkStats() ([]NetworkStat, error) {
+	rows, err := m.db.Query(`SELECT p.network, COUNT(*), COALESCE(SUM(LENGTH(CAST(p.content AS BLOB))), 0), MAX(p.created_at), np.network IS NOT NULL
+		FROM pastes p LEFT JOIN network_passphrases np ON np.network = p.network
+		GROUP BY p.network ORDER BY MAX(p.created_at) DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []NetworkStat
+	for rows.Next() {
+		var s NetworkStat
+		var last sql.NullString
+		if err := rows.Scan(&s.Network, &s.Pastes, &s.Bytes, &last, &s.Protected); err != nil {
+			return nil, err
+		}
+		s.LastPaste = parseTime(last.String)
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
+
+// PurgeNetwork deletes every paste, scheduled paste and collection of the network and
+// returns how many pastes were deleted.
+func (m *Manager) PurgeNetwork(network string) (int64, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM pastes WHERE network = ?", network)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range []string{"scheduled_pastes", "collections"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE network = ?", network); err != nil {
+			return 0, err
+		}
+	}
+	return n, tx.Commit()
+}
+
+// InsertBan stores a ban and returns its ID.
+func (m *Manager) InsertBan(b Ban) (int64, error) {
+	res, err := m.db.Exec("INSERT INTO bans (cidr, reason, created_at, expires_at) VALUES (?, ?, ?, ?)", b.CIDR, b.Reason, b.CreatedAt, b.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetBans returns all bans, newest first.
+func (m *Manager) GetBans() ([]Ban, error) {
+	rows, err := m.db.Query("SELECT id, cidr, reason, created_at, expires_at FROM bans ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		var b Ban
+		var reason sql.NullString
+		var expires sql.NullTime
+		if err := rows.Scan(&b.Id, &b.CIDR, &reason, &b.CreatedAt, &expires); err != nil {
+			return nil, err
+		}
+		b.Reason = reason.String
+		if expires.Valid {
+			b.ExpiresAt = &expires.Time
+		}
+		bans = append(bans, b)
+	}
+
+	return bans, rows.Err()
+}
+
+// DeleteBan lifts a ban based on its ID.
+func (m *Manager) DeleteBan(id int64) error {
+	_, err := m.db.Exec("DELETE FROM bans WHERE id = ?", id)
+	return err
+}
+
+// parseTime parses a timestamp returned by an SQLite expression, where the
+// driver cannot convert it to time.Time on its own.
+func parseTime(s string) time.Time {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// DeleteExpiredBans deletes bans that expired before the given time.
+func (m *Manager) DeleteExpiredBans(before time.Time) (int64, error) {
+	res, err := m.db.Exec("DELETE FROM bans WHERE expires_at IS NOT NULL AND julianday(expires_at) < julianday(?)", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
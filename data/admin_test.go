@@ -0,0 +1,90 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetworkStats(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	for _, content := range []string{"hello", "héllo"} {
+		_, err := manager.InsertPaste(Paste{Network: "test-network", Content: content, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("Failed to insert new paste: %v", err)
+		}
+	}
+	manager.InsertPaste(Paste{Network: "other-network", Content: "x", CreatedAt: time.Now().Add(-time.Hour)})
+	manager.SetPassphrase("test-network", "correct horse")
+
+	stats, err := manager.NetworkStats()
+	if err != nil {
+		t.Fatalf("Failed to fetch network stats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected stats for 2 networks, got %v", len(stats))
+	}
+
+	s := stats[0]
+	if s.Network != "test-network" || s.Pastes != 2 || s.Bytes != 11 || !s.Protected {
+		t.Errorf("Unexpected stats for test-network: %+v", s)
+	}
+	if s.LastPaste.IsZero() || time.Since(s.LastPaste) > time.Minute {
+		t.Errorf("Expected last paste time to be recent, got %v", s.LastPaste)
+	}
+
+	n, err := manager.PurgeNetwork("test-network")
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 pastes to be purged, got %v %v", n, err)
+	}
+	pastes, _ := manager.GetPastes("other-network")
+	if len(pastes) != 1 {
+		t.Errorf("Expected other networks to be untouched, got %v pastes", len(pastes))
+	}
+}
+
+func TestBans(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	expires := time.Now().Add(time.Hour)
+	id, err := manager.InsertBan(Ban{CIDR: "10.0.0.0/8", Reason: "spam", CreatedAt: time.Now(), ExpiresAt: &expires})
+	if err != nil {
+		t.Fatalf("Failed to insert ban: %v", err)
+	}
+	manager.InsertBan(Ban{CIDR: "192.0.2.1", CreatedAt: time.Now()})
+
+	bans, err := manager.GetBans()
+	if err != nil || len(bans) != 2 {
+		t.Fatalf("Expected 2 bans, got %v %v", len(bans), err)
+	}
+	for _, b := range bans {
+		if b.Id == id && (b.Reason != "spam" || b.ExpiresAt == nil) {
+			t.Errorf("Unexpected ban %+v", b)
+		}
+		if b.Id != id && b.ExpiresAt != nil {
+			t.Errorf("Expected permanent ban to have no expiry, got %v", b.ExpiresAt)
+		}
+	}
+
+	if err := manager.DeleteBan(id); err != nil {
+		t.Errorf("Failed to delete ban: %v", err)
+	}
+	bans, _ = manager.GetBans()
+	if len(bans) != 1 {
+		t.Errorf("Expected 1 ban left, got %v", len(bans))
+	}
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// createAttachments is a SQL query that creates the table holding the files of
+// attachment pastes. The file name is the content of the paste.
+const createAttachments = `CREATE TABLE IF NOT EXISTS attachments (
+	id INTEGER NOT NULL PRIMARY KEY,
+	network TEXT NOT NULL,
+	data BLOB NOT NULL,
+	thumbnail BLOB,
+	key_id INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);`
+
+// Attachment describes the file attached to a paste.
+type Attachment struct {
+	Id        int64
+	Name      string
+	Size      int64
+	Mime      string
+	Thumbnail bool
+}
+
+// Image reports whether the attachment is an image browsers can display.
+func (a Attachment) Image() bool {
+	return strings.HasPrefix(a.Mime, "image/")
+}
+
+// InsertAttachment stores the file and its optional thumbnail, and a paste referencing
+// it with p.Attachment describing the file. It returns the inserted paste.
+func (m *Manager) InsertAttachment(p Paste, data, thumbnail []byte) (Paste, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return p, err
+	}
+	defer tx.Rollback()
+
+	if p, err = m.insertAttachment(tx, p, data, thumbnail); err != nil {
+		return p, err
+	}
+	return p, tx.Commit()
+}
+
+// insertAttachment is InsertAttachment within a transaction.
+func (m *Manager) insertAttachment(tx *sql.Tx, p Paste, data, thumbnail []byte) (Paste, error) {
+	if p.Attachment == nil {
+		return p, errors.New("paste has no attachment")
+	}
+	a := *p.Attachment
+	a.Size = int64(len(data))
+	a.Thumbnail = thumbnail != nil
+	p.Content = a.Name
+	p.OneTime = false
+
+	storedData, keyID, err := m.cipher.encryptBytes(data)
+	if err != nil {
+		return p, err
+	}
+	storedThumbnail, _, err := m.cipher.encryptBytes(thumbnail)
+	if err != nil {
+		return p, err
+	}
+
+	res, err := tx.Exec("INSERT INTO attachments (network, data, thumbnail, key_id, created_at) VALUES (?, ?, ?, ?, ?)", p.Network, storedData, storedThumbnail, keyID, time.Now())
+	if err != nil {
+		return p, err
+	}
+	if a.Id, err = res.LastInsertId(); err != nil {
+		return p, err
+	}
+	p.Attachment = &a
+
+	if p.Id, err = m.insertPaste(tx, p); err != nil {
+		return p, err
+	}
+
+	classify(&p)
+	return p, nil
+}
+
+// GetAttachment returns the attachment of the network and its file. It returns
+// sql.ErrNoRows if the network has no such attachment.
+func (m *Manager) GetAttachment(id int64, network string) (Attachment, []byte, error) {
+	paste, err := m.scanPaste(m.db.QueryRow("SELECT "+pasteColumns+" FROM pastes WHERE attachment_id = ? AND network = ? AND deleted_at IS NULL", id, network))
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+
+	var data []byte
+	var keyID int64
+	if err := m.db.QueryRow("SELECT data, key_id FROM attachments WHERE id = ?", id).Scan(&data, &keyID); err != nil {
+		return Attachment{}, nil, err
+	}
+	data, err = m.decryptBytes(data, keyID)
+	return *paste.Attachment, data, err
+}
+
+// GetThumbnail returns the thumbnail of an attachment of the network. It returns
+// sql.ErrNoRows if there is no such attachment or it has no thumbnail.
+func (m *Manager) GetThumbnail(id int64, network string) ([]byte, error) {
+	var thumbnail []byte
+	var keyID int64
+	err := m.db.QueryRow(`SELECT thumbnail, key_id FROM attachments WHERE id = ? AND network = ? AND thumbnail IS NOT NULL
+		AND EXISTS (SELECT 1 FROM pastes WHERE attachment_id = attachments.id AND deleted_at IS NULL)`, id, network).Scan(&thumbnail, &keyID)
+	if err != nil {
+		return nil, err
+	}
+	return m.decryptBytes(thumbnail, keyID)
+}
+
+// reencryptAttachments decrypts every attachment with the current key and encrypts it with next.
+func (m *Manager) reencryptAttachments(tx *sql.Tx, next *rowCipher) error {
+	var ids []int64
+	rows, err := tx.Query("SELECT id FROM attachments")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Attachments are handled one at a time to avoid holding every file in memory
+	for _, id := range ids {
+		var data, thumbnail []byte
+		var keyID int64
+		if err := tx.QueryRow("SELECT data, thumbnail, key_id FROM attachments WHERE id = ?", id).Scan(&data, &thumbnail, &keyID); err != nil {
+			return err
+		}
+		if data, err = m.decryptBytes(data, keyID); err != nil {
+			return err
+		}
+		if thumbnail, err = m.decryptBytes(thumbnail, keyID); err != nil {
+			return err
+		}
+
+		if data, keyID, err = next.encryptBytes(data); err != nil {
+			return err
+		}
+		if thumbnail, _, err = next.encryptBytes(thumbnail); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE attachments SET data = ?, thumbnail = ?, key_id = ? WHERE id = ?", data, thumbnail, keyID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentType returns the content type of an attachment paste.
+func attachmentType(a Attachment) detect.ContentType {
+	if a.Image() {
+		return detect.TypeImage
+	}
+	return detect.TypeFile
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/kuiadev/pastytext/detect"
+)
+
+func TestAttachments(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	key, _ := GenerateKey()
+	t.Setenv("DB_KEY", key)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	file := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	thumbnail := []byte("small")
+	paste, err := manager.InsertAttachment(Paste{
+		Network:    "test-network",
+		User:       "test User",
+		CreatedAt:  time.Now(),
+		Attachment: &Attachment{Name: "screenshot.png", Mime: "image/png"},
+	}, file, thumbnail)
+	if err != nil {
+		t.Fatalf("Failed to insert attachment: %v", err)
+	}
+	if paste.Id == 0 || paste.Type != detect.TypeImage || paste.Attachment.Size != int64(len(file)) {
+		t.Errorf("Expected inserted image paste, got %+v", paste)
+	}
+
+	var stored []byte
+	manager.db.QueryRow("SELECT data FROM attachments").Scan(&stored)
+	if bytes.Contains(stored, []byte("not really a png")) {
+		t.Errorf("Expected attachment to be encrypted at rest")
+	}
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 1 || pastes[0].Attachment == nil || *pastes[0].Attachment != *paste.Attachment || pastes[0].Content != "screenshot.png" {
+		t.Errorf("Expected paste with attachment, got %+v", pastes)
+	}
+
+	a, data, err := manager.GetAttachment(paste.Attachment.Id, "test-network")
+	if err != nil || !bytes.Equal(data, file) || a.Name != "screenshot.png" || !a.Thumbnail {
+		t.Errorf("Expected attachment file, got %+v %v", a, err)
+	}
+	if _, _, err := manager.GetAttachment(paste.Attachment.Id, "other-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected attachment to be scoped to its network, got %v", err)
+	}
+
+	newKey, _ := GenerateKey()
+	master, _ := ParseKey(newKey)
+	if err := manager.RotateKey(master); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	if thumb, err := manager.GetThumbnail(paste.Attachment.Id, "test-network"); err != nil || !bytes.Equal(thumb, thumbnail) {
+		t.Errorf("Expected thumbnail to survive key rotation, got %v %v", thumb, err)
+	}
+
+	manager.DeletePaste(paste.Id)
+	var count int
+	manager.db.QueryRow("SELECT COUNT(*) FROM attachments").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected attachment to be deleted with its paste, got %v", count)
+	}
+}
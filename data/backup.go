@@ -0,0 +1,188 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Scheduled backups are named after the time they were made, so that their names sort
+// from oldest to newest.
+const (
+	backupPrefix = "pastytext-"
+	backupTime   = "20060102-150405"
+	backupExt    = ".db"
+)
+
+// ErrNewerBackup is returned when restoring a backup made by a newer version of
+// PastyText, whose schema this version does not know.
+var ErrNewerBackup = errors.New("backup was made by a newer version of PastyText")
+
+// Backup writes a consistent snapshot of the database to path with VACUUM INTO, which
+// is safe while the database is in use. The snapshot is written next to path first so
+// that path never holds a partial backup.
+func (m *Manager) Backup(path string) error {
+	return vacuumInto(m.db, path)
+}
+
+// BackupFile writes a snapshot of the database in DB_FILE to path like Backup, but opens
+// the database read-only instead of with NewManager, so that a server using it is not
+// migrated or written to behind its back.
+func BackupFile(path string) error {
+	dbFile, err := dbPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbFile); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+dbFile+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return vacuumInto(db, path)
+}
+
+func vacuumInto(db *sql.DB, path string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := db.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// BackupTo writes a backup named after the current time into dir, and then removes the
+// oldest backups of dir until at most keep are left. It returns the path of the backup.
+func (m *Manager) BackupTo(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format(backupTime)+backupExt)
+	if err := m.Backup(path); err != nil {
+		return "", err
+	}
+	return path, rotateBackups(dir, keep)
+}
+
+// rotateBackups removes the oldest backups of dir until at most keep are left.
+func rotateBackups(dir string, keep int) error {
+	backups, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupExt))
+	if err != nil {
+		return err
+	}
+	slices.Sort(backups)
+
+	for len(backups) > max(keep, 1) {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// CheckBackup opens the backup at path read-only and returns its schema version. It
+// fails if the file is not an intact PastyText database or was made by a newer version.
+// Whether the backup can be decrypted with the current key is only known when opening it.
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("cannot read backup: %w", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("backup is corrupted: %s", result)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'pastes'").Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, errors.New("backup is not a PastyText database")
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return version, fmt.Errorf("%w: schema version %d, expected at most %d", ErrNewerBackup, version, len(migrations))
+	}
+	return version, nil
+}
+
+// Restore replaces the database in DB_FILE with the backup at path once CheckBackup
+// accepts it. Older backups are migrated when the database is next opened. The database
+// must not be in use; the replaced one is kept next to it with a .pre-restore suffix.
+func Restore(path string) error {
+	if _, err := CheckBackup(path); err != nil {
+		return err
+	}
+
+	dbFile, err := dbPath()
+	if err != nil {
+		return err
+	}
+
+	// The backup is copied next to the database first so that the swap is a rename
+	tmp := dbFile + ".restore"
+	if err := copyFile(path, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// A journal left next to the database belongs to it and must not be applied to the backup
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		err := os.Rename(dbFile+suffix, dbFile+".pre-restore"+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dbFile)
+}
+
+// copyFile copies the file at src to dst and syncs it to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DB_FILE", filepath.Join(dir, "pastytext.db"))
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	manager.InsertPaste(Paste{Network: "test-network", Content: "before backup", CreatedAt: time.Now()})
+
+	backup := filepath.Join(dir, "backup.db")
+	if err := manager.Backup(backup); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if err := manager.Backup(backup); err != nil {
+		t.Errorf("Expected an existing backup to be replaced, got %v", err)
+	}
+	manager.InsertPaste(Paste{Network: "test-network", Content: "after backup", CreatedAt: time.Now()})
+	manager.Close()
+
+	if version, err := CheckBackup(backup); err != nil || version != len(migrations) {
+		t.Errorf("Expected backup with schema version %v, got %v %v", len(migrations), version, err)
+	}
+	if err := Restore(backup); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pastytext.db.pre-restore")); err != nil {
+		t.Errorf("Expected the replaced database to be kept, got %v", err)
+	}
+
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer manager.Close()
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 1 || pastes[0].Content != "before backup" {
+		t.Errorf("Expected only the paste of the backup, got %v", pastes)
+	}
+}
+
+func TestCheckBackup(t *testing.T) {
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte("not a database at all, just some text"), 0600)
+	if _, err := CheckBackup(garbage); err == nil {
+		t.Error("Expected a file that is not a database to be refused")
+	}
+
+	other := filepath.Join(dir, "other.db")
+	db, _ := sql.Open("sqlite3", other)
+	db.Exec("CREATE TABLE notes (id INTEGER)")
+	db.Close()
+	if _, err := CheckBackup(other); err == nil {
+		t.Error("Expected a database without pastes to be refused")
+	}
+
+	newer := filepath.Join(dir, "newer.db")
+	db, _ = sql.Open("sqlite3", newer)
+	db.Exec(create)
+	db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations)+1))
+	db.Close()
+	if _, err := CheckBackup(newer); !errors.Is(err, ErrNewerBackup) {
+		t.Errorf("Expected a backup of a newer version to be refused, got %v", err)
+	}
+
+	t.Setenv("DB_FILE", filepath.Join(dir, "pastytext.db"))
+	if err := Restore(newer); !errors.Is(err, ErrNewerBackup) {
+		t.Errorf("Expected restore of a newer backup to fail, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pastytext.db")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be restored, got %v", err)
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DB_FILE", filepath.Join(dir, "pastytext.db"))
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	backups := filepath.Join(dir, "backups")
+	os.MkdirAll(backups, 0750)
+	for _, name := range []string{"pastytext-20240101-000000.db", "pastytext-20240102-000000.db", "notes.txt"} {
+		os.WriteFile(filepath.Join(backups, name), nil, 0600)
+	}
+
+	path, err := manager.BackupTo(backups, 2)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if _, err := CheckBackup(path); err != nil {
+		t.Errorf("Expected a valid backup, got %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(backups, "*"))
+	expected := []string{filepath.Join(backups, "notes.txt"), filepath.Join(backups, "pastytext-20240102-000000.db"), path}
+	if fmt.Sprint(files) != fmt.Sprint(expected) {
+		t.Errorf("Expected the oldest backup to be removed, got %v", files)
+	}
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"strings"
+	"time"
+)
+
+// Selection picks pastes of a network for bulk deletion. Empty fields match every paste.
+type Selection struct {
+	// Ids limits the selection to these pastes.
+	Ids []int64
+	// Before limits the selection to pastes created before this time.
+	Before time.Time
+	// Author limits the selection to the pastes of a device, see Paste.Author.
+	Author string
+	// KeepPinned leaves pinned pastes out of the selection.
+	KeepPinned bool
+}
+
+// where returns the conditions of the selection to append to a WHERE clause, and their arguments.
+func (s Selection) where() (string, []any) {
+	var where string
+	var args []any
+	if s.Ids != nil {
+		where += " AND id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(s.Ids)), ",") + ")"
+		for _, id := range s.Ids {
+			args = append(args, id)
+		}
+	}
+	if !s.Before.IsZero() {
+		where += " AND julianday(created_at) < julianday(?)"
+		args = append(args, s.Before)
+	}
+	if s.Author != "" {
+		where += " AND author = ?"
+		args = append(args, s.Author)
+	}
+	if s.KeepPinned {
+		where += " AND pinned = 0"
+	}
+	return where, args
+}
+
+// CountPastes returns how many pastes of the network the selection matches.
+func (m *Manager) CountPastes(network string, s Selection) (int, error) {
+	if s.Ids != nil && len(s.Ids) == 0 {
+		return 0, nil
+	}
+	where, args := s.where()
+	var count int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM pastes WHERE network = ? AND deleted_at IS NULL"+where, append([]any{network}, args...)...).Scan(&count)
+	return count, err
+}
+
+// DeletePastes deletes the pastes of the network matching the selection in a single
+// transaction and returns their IDs. With trash set they are moved to the trash as
+// deleted by the given user at the given time, otherwise they are deleted right away.
+func (m *Manager) DeletePastes(network string, s Selection, by string, at time.Time, trash bool) ([]int64, error) {
+	if s.Ids != nil && len(s.Ids) == 0 {
+		return nil, nil
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := s.where()
+	query := "DELETE FROM pastes WHERE network = ? AND deleted_at IS NULL" + where + " RETURNING id"
+	args = append([]any{network}, args...)
+	if trash {
+		query = "UPDATE pastes SET deleted_at = ?, deleted_by = ? WHERE network = ? AND deleted_at IS NULL" + where + " RETURNING id"
+		args = append([]any{at, by}, args...)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
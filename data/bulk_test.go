@@ -0,0 +1,60 @@
+package data
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeletePastes(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	old, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "old", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	pinned, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "pinned", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	mine, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Author: "brave-device", Content: "mine", CreatedAt: time.Now()})
+	theirs, _ := manager.InsertPaste(Paste{Network: "test-network", User: "CALM-FOX", Author: "calm-device", Content: "theirs", CreatedAt: time.Now()})
+	other, _ := manager.InsertPaste(Paste{Network: "other-network", Content: "other", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	manager.PinPaste(pinned, "test-network", true)
+
+	before := Selection{Before: time.Now().Add(-time.Hour), KeepPinned: true}
+	if n, err := manager.CountPastes("test-network", before); err != nil || n != 1 {
+		t.Errorf("Expected 1 paste before an hour ago, got %v %v", n, err)
+	}
+	ids, err := manager.DeletePastes("test-network", before, "BRAVE-OTTER", time.Now(), true)
+	if err != nil || !slices.Equal(ids, []int64{old}) {
+		t.Errorf("Expected the old unpinned paste to be deleted, got %v %v", ids, err)
+	}
+	if trash, _ := manager.TrashedPastes("test-network", time.Now().Add(-time.Minute)); len(trash) != 1 || trash[0].DeletedBy != "BRAVE-OTTER" {
+		t.Errorf("Expected the old paste in the trash, got %v", trash)
+	}
+
+	// Listed pastes of other networks are left alone
+	ids, _ = manager.DeletePastes("test-network", Selection{Ids: []int64{other, theirs}, Author: "brave-device"}, "BRAVE-OTTER", time.Now(), false)
+	if len(ids) != 0 {
+		t.Errorf("Expected only the user's pastes of the network to be deleted, got %v", ids)
+	}
+	ids, _ = manager.DeletePastes("test-network", Selection{Ids: []int64{other, mine, pinned}}, "BRAVE-OTTER", time.Now(), false)
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int64{pinned, mine}) {
+		t.Errorf("Expected listed pastes of the network to be deleted, got %v", ids)
+	}
+
+	if ids, _ := manager.DeletePastes("test-network", Selection{Ids: []int64{}}, "BRAVE-OTTER", time.Now(), false); ids != nil {
+		t.Errorf("Expected an empty list to delete nothing, got %v", ids)
+	}
+
+	ids, _ = manager.DeletePastes("test-network", Selection{KeepPinned: true}, "BRAVE-OTTER", time.Now(), false)
+	if !slices.Equal(ids, []int64{theirs}) {
+		t.Errorf("Expected the rest of the network to be cleared, got %v", ids)
+	}
+	if pastes, _ := manager.GetPastes("other-network"); len(pastes) != 1 {
+		t.Errorf("Expected other network to be untouched, got %v", pastes)
+	}
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// PasteFilter selects pastes in FindPastes. Empty fields match every paste.
+type PasteFilter struct {
+	Type     detect.ContentType
+	Language string
+	// Tags selects the pastes having all of these tags, given as NormalizeTag returns them.
+	Tags []string
+	// Collection selects the pastes in the collection with this ID.
+	Collection int64
+}
+
+// where returns the conditions of the filter to append to a WHERE clause, and their arguments.
+func (f PasteFilter) where() (string, []any) {
+	var where string
+	var args []any
+	if f.Type != "" {
+		where += " AND type = ?"
+		args = append(args, f.Type)
+	}
+	if f.Language != "" {
+		where += " AND language = ?"
+		args = append(args, f.Language)
+	}
+	for _, tag := range f.Tags {
+		where += " AND EXISTS (SELECT 1 FROM paste_tags WHERE paste_id = pastes.id AND tag = ?)"
+		args = append(args, tag)
+	}
+	if f.Collection != 0 {
+		where += " AND collection_id = ?"
+		args = append(args, f.Collection)
+	}
+	return where, args
+}
+
+// classify fills in the secret kind, content type and language of a paste. End-to-end
+// encrypted pastes are left alone as their content is not readable, and attachments
+// are typed by their file.
+func classify(p *Paste) {
+	if p.Encrypted() {
+		return
+	}
+	if p.Attachment != nil {
+		p.Type = attachmentType(*p.Attachment)
+		return
+	}
+
+	if p.Secret == detect.None {
+		p.Secret = detect.Classify(p.Content)
+	}
+	p.Type, p.Language = detect.TypeOf(p.Content)
+	if p.Secret != detect.None {
+		p.Type = detect.TypeSecret
+	}
+}
+
+// classifyPastes classifies the plain text pastes stored before pastes were classified on insert.
+func (m *Manager) classifyPastes() error {
+	rows, err := m.db.Query("SELECT " + pasteColumns + " FROM pastes WHERE type = '' AND encryption = ''")
+	if err != nil {
+		return err
+	}
+
+	var pastes []Paste
+	for rows.Next() {
+		p, err := m.scanPaste(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		classify(&p)
+		pastes = append(pastes, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range pastes {
+		if _, err := m.db.Exec("UPDATE pastes SET secret = ?, type = ?, language = ? WHERE id = ?", p.Secret, p.Type, p.Language, p.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
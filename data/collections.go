@@ -0,0 +1,208 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kuiadev/pastytext/detect"
+	"github.com/mattn/go-sqlite3"
+)
+
+// createCollections is a SQL query that creates the table of named collections grouping
+// the pastes of a network.
+const createCollections = `CREATE TABLE IF NOT EXISTS collections (
+	id INTEGER NOT NULL PRIMARY KEY,
+	network TEXT NOT NULL,
+	name TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	UNIQUE (network, name)
+);`
+
+// maxCollectionName is the longest collection name in characters.
+const maxCollectionName = 64
+
+var (
+	// ErrInvalidCollectionName is returned for empty or too long collection names.
+	ErrInvalidCollectionName = fmt.Errorf("collection names must be 1 to %d characters long, without control characters", maxCollectionName)
+	// ErrCollectionExists is returned when a network already has a collection of that name.
+	ErrCollectionExists = errors.New("a collection with this name already exists")
+)
+
+// Collection is a named group of pastes of a network.
+type Collection struct {
+	Id        int64
+	Name      string
+	CreatedAt time.Time
+	// Count is the number of pastes in the collection, trash excluded.
+	Count int
+}
+
+// normalizeCollectionName trims the name and checks that it is a valid collection name.
+func normalizeCollectionName(s string) (string, error) {
+	name := strings.TrimSpace(s)
+	if name == "" || utf8.RuneCountInString(name) > maxCollectionName || strings.ContainsFunc(name, unicode.IsControl) {
+		return "", ErrInvalidCollectionName
+	}
+	return name, nil
+}
+
+// collectionError turns a unique constraint failure on the name into ErrCollectionExists.
+func collectionError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrCollectionExists
+	}
+	return err
+}
+
+// CreateCollection adds a collection to the network and returns it. It returns
+// ErrInvalidCollectionName for invalid names and ErrCollectionExists if the network
+// already has a collection of that name.
+func (m *Manager) CreateCollection(network, name string) (Collection, error) {
+	name, err := normalizeCollectionName(name)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	c := Collection{Name: name, CreatedAt: time.Now()}
+	res, err := m.db.Exec("INSERT INTO collections (network, name, created_at) VALUES (?, ?, ?)", network, c.Name, c.CreatedAt)
+	if err != nil {
+		return Collection{}, collectionError(err)
+	}
+	c.Id, err = res.LastInsertId()
+	return c, err
+}
+
+// RenameCollection renames a collection of the network. It returns sql.ErrNoRows if the
+// network has no such collection, and the errors of CreateCollection for the name.
+func (m *Manager) RenameCollection(id int64, network, name string) error {
+	name, err := normalizeCollectionName(name)
+	if err != nil {
+		return err
+	}
+
+	res, err := m.db.Exec("UPDATE collections SET name = ? WHERE id = ? AND network = ?", name, id, network)
+	if err != nil {
+		return collectionError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteCollection deletes a collection of the network. Its pastes are kept and no longer
+// belong to a collection. It returns sql.ErrNoRows if the network has no such collection.
+func (m *Manager) DeleteCollection(id int64, network string) error {
+	res, err := m.db.Exec("DELETE FROM collections WHERE id = ? AND network = ?", id, network)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetCollection returns a collection of the network, or sql.ErrNoRows if it has no such collection.
+func (m *Manager) GetCollection(id int64, network string) (Collection, error) {
+	var c Collection
+	err := m.db.QueryRow(`SELECT id, name, created_at, (SELECT COUNT(*) FROM pastes WHERE collection_id = collections.id AND deleted_at IS NULL)
+		FROM collections WHERE id = ? AND network = ?`, id, network).Scan(&c.Id, &c.Name, &c.CreatedAt, &c.Count)
+	return c, err
+}
+
+// Collections returns the collections of the network sorted by name.
+func (m *Manager) Collections(network string) ([]Collection, error) {
+	rows, err := m.db.Query(`SELECT id, name, created_at, (SELECT COUNT(*) FROM pastes WHERE collection_id = collections.id AND deleted_at IS NULL)
+		FROM collections WHERE network = ? ORDER BY name COLLATE NOCASE, id`, network)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.Id, &c.Name, &c.CreatedAt, &c.Count); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// MovePaste moves a paste of the network into one of its collections, or out of its
+// collection when collectionID is 0. Replies follow the paste they reply to and cannot
+// be moved themselves. It returns sql.ErrNoRows if the network has no such paste or
+// collection.
+func (m *Manager) MovePaste(id int64, network string, collectionID int64) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if collectionID != 0 {
+		var exists int
+		if err := tx.QueryRow("SELECT 1 FROM collections WHERE id = ? AND network = ?", collectionID, network).Scan(&exists); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Exec("UPDATE pastes SET collection_id = ? WHERE id = ? AND network = ? AND parent_id = 0 AND deleted_at IS NULL", collectionID, id, network)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// WriteCollection writes the pastes of a collection of the network to w as a single text
+// document, oldest first and separated by blank lines. End-to-end encrypted pastes,
+// one-time pastes and attachments are left out, as they have no text the server can
+// share, and so are pastes with a detected secret, which are only shown once revealed.
+// It returns sql.ErrNoRows if the network has no such collection.
+func (m *Manager) WriteCollection(w io.Writer, id int64, network string) error {
+	if _, err := m.GetCollection(id, network); err != nil {
+		return err
+	}
+
+	rows, err := m.db.Query("SELECT "+pasteColumns+" FROM pastes WHERE collection_id = ? AND network = ? AND parent_id = 0 AND deleted_at IS NULL ORDER BY created_at, id", id, network)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var parts []string
+	for rows.Next() {
+		p, err := m.scanPaste(rows)
+		if err != nil {
+			return err
+		}
+		if p.Encrypted() || p.OneTime || p.Attachment != nil || p.Secret != detect.None {
+			continue
+		}
+		parts = append(parts, strings.TrimRight(p.Content, "\n")+"\n")
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, strings.Join(parts, "\n"))
+	return err
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollections(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	deploy, err := manager.CreateCollection("test-network", "  Deploy configs ")
+	if err != nil || deploy.Name != "Deploy configs" {
+		t.Fatalf("Failed to create collection: %v %v", deploy, err)
+	}
+	if _, err := manager.CreateCollection("test-network", "Deploy configs"); err != ErrCollectionExists {
+		t.Errorf("Expected duplicate name to be refused, got %v", err)
+	}
+	if _, err := manager.CreateCollection("other-network", "Deploy configs"); err != nil {
+		t.Errorf("Expected another network to use the same name, got %v", err)
+	}
+	for _, name := range []string{"", "   ", "tab\tname", strings.Repeat("a", maxCollectionName+1)} {
+		if _, err := manager.CreateCollection("test-network", name); !errors.Is(err, ErrInvalidCollectionName) {
+			t.Errorf("Expected %q to be refused, got %v", name, err)
+		}
+	}
+	notes, _ := manager.CreateCollection("test-network", "notes")
+
+	created := time.Now().Add(-time.Hour)
+	env, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "DATABASE_URL=postgres://db/app\n", CreatedAt: created})
+	compose, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "services:\n  app:\n    image: app", CreatedAt: created.Add(time.Minute)})
+	encrypted, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "v1:AAAA:BBBB", Encryption: EncryptionE2E, CreatedAt: created.Add(2 * time.Minute)})
+	secret, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "Tr0ub4dor&3", CreatedAt: created.Add(3 * time.Minute)})
+	other, _ := manager.InsertPaste(Paste{Network: "other-network", Content: "elsewhere", CreatedAt: created})
+
+	for _, id := range []int64{compose, env, encrypted, secret} {
+		if err := manager.MovePaste(id, "test-network", deploy.Id); err != nil {
+			t.Fatalf("Failed to move paste: %v", err)
+		}
+	}
+	if err := manager.MovePaste(other, "test-network", deploy.Id); err != sql.ErrNoRows {
+		t.Errorf("Expected paste of another network not to be moved, got %v", err)
+	}
+	otherCollections, _ := manager.Collections("other-network")
+	if err := manager.MovePaste(env, "test-network", otherCollections[0].Id); err != sql.ErrNoRows {
+		t.Errorf("Expected collection of another network to be refused, got %v", err)
+	}
+	reply, _ := manager.InsertReply(Paste{Network: "test-network", Content: "got it", ParentId: env, CreatedAt: time.Now()})
+	if err := manager.MovePaste(reply.Id, "test-network", notes.Id); err != sql.ErrNoRows {
+		t.Errorf("Expected reply not to be moved, got %v", err)
+	}
+
+	pastes, _ := manager.FindPastes("test-network", PasteFilter{Collection: deploy.Id})
+	if len(pastes) != 4 {
+		t.Errorf("Expected the pastes of the collection, got %v", pastes)
+	}
+	collections, _ := manager.Collections("test-network")
+	if len(collections) != 2 || collections[0].Id != deploy.Id || collections[0].Count != 4 || collections[1].Count != 0 {
+		t.Errorf("Expected collections sorted by name with their counts, got %v", collections)
+	}
+
+	var doc bytes.Buffer
+	if err := manager.WriteCollection(&doc, deploy.Id, "test-network"); err != nil {
+		t.Fatalf("Failed to write collection: %v", err)
+	}
+	if want := "DATABASE_URL=postgres://db/app\n\nservices:\n  app:\n    image: app\n"; doc.String() != want {
+		t.Errorf("Expected the text pastes oldest first without secrets, got %q", doc.String())
+	}
+	if err := manager.WriteCollection(&doc, deploy.Id, "other-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected collection of another network not to be written, got %v", err)
+	}
+
+	if err := manager.RenameCollection(notes.Id, "test-network", "Deploy configs"); err != ErrCollectionExists {
+		t.Errorf("Expected rename to a used name to be refused, got %v", err)
+	}
+	if err := manager.RenameCollection(deploy.Id, "test-network", "release"); err != nil {
+		t.Fatalf("Failed to rename collection: %v", err)
+	}
+	if c, _ := manager.GetCollection(deploy.Id, "test-network"); c.Name != "release" {
+		t.Errorf("Expected collection to be renamed, got %v", c)
+	}
+
+	if err := manager.MovePaste(env, "test-network", 0); err != nil {
+		t.Fatalf("Failed to move paste out of its collection: %v", err)
+	}
+	if err := manager.DeleteCollection(deploy.Id, "other-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected collection of another network not to be deleted, got %v", err)
+	}
+	if err := manager.DeleteCollection(deploy.Id, "test-network"); err != nil {
+		t.Fatalf("Failed to delete collection: %v", err)
+	}
+	paste, err := manager.GetPaste(compose)
+	if err != nil || paste.CollectionId != 0 {
+		t.Errorf("Expected pastes of a deleted collection to be kept outside of it, got %v %v", paste, err)
+	}
+}
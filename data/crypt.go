@@ -0,0 +1,324 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// createKeys is a SQL query that creates the table of wrapped data keys used to
+// encrypt paste contents at rest.
+const createKeys = `CREATE TABLE IF NOT EXISTS encryption_keys (
+	id INTEGER NOT NULL PRIMARY KEY,
+	wrapped BLOB NOT NULL,
+	created_at DATETIME NOT NULL
+);`
+
+// KeySize is the size in bytes of the master key given in DB_KEY or DB_KEY_FILE.
+const KeySize = 32
+
+var (
+	// ErrKeyRequired is returned when opening an encrypted database without a key.
+	ErrKeyRequired = errors.New("database is encrypted, set DB_KEY or DB_KEY_FILE to open it")
+	// ErrWrongKey is returned when the key cannot unwrap the data key of the database.
+	ErrWrongKey = errors.New("database key does not match the key the database was encrypted with")
+)
+
+// rowCipher encrypts paste contents with a data key. The data key itself is stored in
+// the database wrapped by the master key, which is never stored.
+type rowCipher struct {
+	keyID int64
+	aead  cipher.AEAD
+
+	// hashKey keys the content hashes so they do not reveal guessable contents.
+	hashKey []byte
+}
+
+// newRowCipher creates the cipher for a data key.
+func newRowCipher(keyID int64, dek []byte) (*rowCipher, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, dek)
+	mac.Write([]byte("content-hash"))
+	return &rowCipher{keyID: keyID, aead: aead, hashKey: mac.Sum(nil)}, nil
+}
+
+// hash returns the hash of the content used to find identical pastes. Without a
+// cipher it is a plain SHA-256, otherwise an HMAC keyed by the data key.
+func (c *rowCipher) hash(content string) string {
+	if c == nil {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateKey returns a new random master key, base64 encoded as expected in DB_KEY.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 encoded master key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes encoded in base64", KeySize)
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a base64 encoded master key from a file.
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(b))
+}
+
+// masterKey returns the master key from DB_KEY or DB_KEY_FILE, or nil if neither is set.
+func masterKey() ([]byte, error) {
+	if s := os.Getenv("DB_KEY"); s != "" {
+		return ParseKey(s)
+	}
+	if path := os.Getenv("DB_KEY_FILE"); path != "" {
+		return ReadKeyFile(path)
+	}
+	return nil, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with a fresh random nonce, which is prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// setupEncryption loads the data key of an encrypted database, or encrypts the
+// database when a master key is given for the first time.
+func (m *Manager) setupEncryption(master []byte) error {
+	var wrapped []byte
+	var keyID int64
+	err := m.db.QueryRow("SELECT id, wrapped FROM encryption_keys ORDER BY id DESC LIMIT 1").Scan(&keyID, &wrapped)
+	if errors.Is(err, sql.ErrNoRows) {
+		if master == nil {
+			return nil
+		}
+		return m.RotateKey(master)
+	}
+	if err != nil {
+		return err
+	}
+	if master == nil {
+		return ErrKeyRequired
+	}
+
+	kek, err := newAEAD(master)
+	if err != nil {
+		return err
+	}
+	dek, err := open(kek, wrapped)
+	if err != nil {
+		return ErrWrongKey
+	}
+	m.cipher, err = newRowCipher(keyID, dek)
+	return err
+}
+
+// RotateKey creates a new data key wrapped by the master key and re-encrypts every
+// paste, paste version, scheduled paste and attachment with it. Afterwards the database
+// can only be opened with the new master key. It also encrypts a database that was not
+// encrypted before.
+func (m *Manager) RotateKey(master []byte) error {
+	kek, err := newAEAD(master)
+	if err != nil {
+		return err
+	}
+
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return err
+	}
+	wrapped, err := seal(kek, dek)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO encryption_keys (wrapped, created_at) VALUES (?, ?)", wrapped, time.Now())
+	if err != nil {
+		return err
+	}
+	keyID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	next, err := newRowCipher(keyID, dek)
+	if err != nil {
+		return err
+	}
+
+	if err := m.reencryptPastes(tx, next); err != nil {
+		return err
+	}
+	if err := m.reencryptAttachments(tx, next); err != nil {
+		return err
+	}
+	if err := m.reencryptVersions(tx, next); err != nil {
+		return err
+	}
+	if err := m.reencryptScheduled(tx, next); err != nil {
+		return err
+	}
+	// Tags taken from contents would leak them, tags set by hand are kept
+	if _, err := tx.Exec("DELETE FROM paste_tags WHERE manual = 0"); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM encryption_keys WHERE id != ?", keyID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.cipher = next
+	return nil
+}
+
+// reencryptPastes decrypts every paste with the current key and encrypts it with next.
+// Content hashes are keyed by the data key too, so they are computed again.
+func (m *Manager) reencryptPastes(tx *sql.Tx, next *rowCipher) error {
+	rows, err := tx.Query("SELECT id, content, key_id FROM pastes")
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		id      int64
+		content string
+	}
+	var all []row
+	for rows.Next() {
+		var r row
+		var content sql.NullString
+		var keyID int64
+		if err := rows.Scan(&r.id, &content, &keyID); err != nil {
+			rows.Close()
+			return err
+		}
+		if r.content, err = m.decrypt(content.String, keyID); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range all {
+		content, keyID, err := next.encrypt(r.content)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE pastes SET content = ?, key_id = ?, content_hash = ? WHERE id = ?", content, keyID, next.hash(r.content), r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encrypt returns the content to store and the ID of the key it was encrypted with.
+// Without a cipher the content is stored as is with key ID 0.
+func (c *rowCipher) encrypt(content string) (string, int64, error) {
+	if c == nil {
+		return content, 0, nil
+	}
+	sealed, keyID, err := c.encryptBytes([]byte(content))
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), keyID, nil
+}
+
+// encryptBytes is like encrypt for binary data, which is stored without base64 encoding.
+func (c *rowCipher) encryptBytes(b []byte) ([]byte, int64, error) {
+	if c == nil || b == nil {
+		return b, 0, nil
+	}
+	sealed, err := seal(c.aead, b)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sealed, c.keyID, nil
+}
+
+// decrypt returns the plain content of a stored value.
+func (m *Manager) decrypt(stored string, keyID int64) (string, error) {
+	if keyID == 0 {
+		return stored, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", err
+	}
+	pt, err := m.decryptBytes(sealed, keyID)
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// decryptBytes returns the plain data of a stored binary value.
+func (m *Manager) decryptBytes(stored []byte, keyID int64) ([]byte, error) {
+	if keyID == 0 || stored == nil {
+		return stored, nil
+	}
+	if m.cipher == nil || m.cipher.keyID != keyID {
+		return nil, ErrKeyRequired
+	}
+	return open(m.cipher.aead, stored)
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncryptionAtRest(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	// Start with a plain text database
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	before, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "before encryption #launch", CreatedAt: time.Now()})
+	manager.SetTags(before, "test-network", []string{"kept"})
+	manager.Close()
+
+	key, _ := GenerateKey()
+	t.Setenv("DB_KEY", key)
+
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager with key: %v", err)
+	}
+	manager.InsertPaste(Paste{Network: "test-network", Content: "after encryption #plans", CreatedAt: time.Now()})
+
+	// Hashtags would give the contents away, tags set by hand are kept
+	if counts, _ := manager.TagCounts("test-network"); len(counts) != 1 || counts[0].Tag != "kept" {
+		t.Errorf("Expected only the tag set by hand to be stored, got %v", counts)
+	}
+
+	rows, _ := manager.db.Query("SELECT content, key_id FROM pastes")
+	for rows.Next() {
+		var content string
+		var keyID int64
+		rows.Scan(&content, &keyID)
+		if keyID == 0 || content == "before encryption #launch" || content == "after encryption #plans" {
+			t.Errorf("Expected content to be encrypted at rest, got %q with key %v", content, keyID)
+		}
+	}
+	rows.Close()
+
+	pastes, err := manager.GetPastes("test-network")
+	if err != nil || len(pastes) != 2 || pastes[0].Content != "after encryption #plans" || pastes[1].Content != "before encryption #launch" {
+		t.Errorf("Expected pastes to be decrypted transparently, got %v %v", pastes, err)
+	}
+	manager.Close()
+
+	t.Setenv("DB_KEY", "")
+	if _, err := NewManager(); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected encrypted database to require a key, got %v", err)
+	}
+
+	wrong, _ := GenerateKey()
+	t.Setenv("DB_KEY", wrong)
+	if _, err := NewManager(); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected wrong key to be refused, got %v", err)
+	}
+
+	t.Setenv("DB_KEY", "not a key")
+	if _, err := NewManager(); err == nil {
+		t.Errorf("Expected malformed key to be refused")
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	oldKey, _ := GenerateKey()
+	t.Setenv("DB_KEY", oldKey)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	manager.InsertPaste(Paste{Network: "test-network", Content: "rotate me", CreatedAt: time.Now()})
+
+	newKey, _ := GenerateKey()
+	master, _ := ParseKey(newKey)
+	if err := manager.RotateKey(master); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	manager.Close()
+
+	if _, err := NewManager(); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected old key to stop working after rotation, got %v", err)
+	}
+
+	// The new key is read from a file this time
+	keyFile := filepath.Join(t.TempDir(), "db.key")
+	os.WriteFile(keyFile, []byte(newKey+"\n"), 0600)
+	t.Setenv("DB_KEY", "")
+	t.Setenv("DB_KEY_FILE", keyFile)
+
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatalf("Failed to open database with rotated key: %v", err)
+	}
+	defer manager.Close()
+
+	pastes, err := manager.GetPastes("test-network")
+	if err != nil || len(pastes) != 1 || pastes[0].Content != "rotate me" {
+		t.Errorf("Expected paste to survive key rotation, got %v %v", pastes, err)
+	}
+
+	var keys int
+	manager.db.QueryRow("SELECT COUNT(*) FROM encryption_keys").Scan(&keys)
+	if keys != 1 {
+		t.Errorf("Expected old data keys to be removed, got %v keys", keys)
+	}
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// defaultDedupWindow is how recent an identical paste must be to be bumped unless
+// DEDUP_WINDOW or the network settings say otherwise.
+const defaultDedupWindow = time.Minute * 5
+
+// newDedupWindow returns the default deduplication window from DEDUP_WINDOW.
+// A window of 0 turns deduplication off for networks that did not set their own.
+func newDedupWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DEDUP_WINDOW")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultDedupWindow
+}
+
+// bumpDuplicate looks for an identical paste of the network within the deduplication
+// window. If there is one it is moved to the top and the user added to the devices that
+// also pasted it, and its ID is returned with ok set. It runs in the transaction that
+// inserts the paste otherwise.
+func (m *Manager) bumpDuplicate(tx *sql.Tx, p Paste) (id int64, ok bool, err error) {
+	if p.Encrypted() || p.OneTime || p.Attachment != nil || p.ParentId != 0 {
+		return 0, false, nil
+	}
+
+	settings, err := m.GetSettings(p.Network)
+	if err != nil || !settings.Dedup {
+		return 0, false, err
+	}
+	window := settings.DedupWindow
+	if window == 0 {
+		window = m.dedupWindow
+	}
+	if window <= 0 {
+		return 0, false, nil
+	}
+
+	var user, also string
+	err = tx.QueryRow(`SELECT id, user, also_pasted_by FROM pastes
+		WHERE network = ? AND content_hash = ? AND parent_id = 0 AND deleted_at IS NULL AND one_time = 0 AND attachment_id = 0 AND julianday(created_at) >= julianday(?)
+		ORDER BY created_at DESC LIMIT 1`,
+		p.Network, m.cipher.hash(p.Content), p.CreatedAt.Add(-window)).Scan(&id, &user, &also)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	alsoPastedBy := parseAlsoPastedBy(also)
+	if p.User != user && !slices.Contains(alsoPastedBy, p.User) {
+		alsoPastedBy = append(alsoPastedBy, p.User)
+	}
+	b, err := json.Marshal(alsoPastedBy)
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = tx.Exec("UPDATE pastes SET created_at = ?, also_pasted_by = ? WHERE id = ?", p.CreatedAt, string(b), id)
+	return id, err == nil, err
+}
+
+// parseAlsoPastedBy decodes the also_pasted_by column, which is empty or a JSON array.
+func parseAlsoPastedBy(s string) []string {
+	var users []string
+	if s != "" {
+		json.Unmarshal([]byte(s), &users)
+	}
+	return users
+}
+
+// hashPastes fills in the content hash of the pastes stored before pastes were hashed on
+// insert, so that they are found as duplicates too.
+func (m *Manager) hashPastes() error {
+	rows, err := m.db.Query("SELECT " + pasteColumns + " FROM pastes WHERE content_hash = ''")
+	if err != nil {
+		return err
+	}
+
+	var pastes []Paste
+	for rows.Next() {
+		p, err := m.scanPaste(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		pastes = append(pastes, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(pastes) == 0 {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range pastes {
+		if _, err := tx.Exec("UPDATE pastes SET content_hash = ? WHERE id = ?", m.cipher.hash(p.Content), p.Id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
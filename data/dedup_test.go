@@ -0,0 +1,171 @@
+package data
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	start := time.Now().Add(-time.Minute)
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "https://example.com", CreatedAt: start})
+	manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "other", CreatedAt: start.Add(time.Second)})
+
+	for _, user := range []string{"CALM-FOX", "BRAVE-OTTER", "CALM-FOX"} {
+		dup, err := manager.InsertPaste(Paste{Network: "test-network", User: user, Content: "https://example.com", CreatedAt: time.Now()})
+		if err != nil || dup != id {
+			t.Errorf("Expected duplicate to bump paste %v, got %v %v", id, dup, err)
+		}
+	}
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 2 || pastes[0].Id != id {
+		t.Fatalf("Expected duplicate paste to be bumped to the top, got %v", pastes)
+	}
+	if !slices.Equal(pastes[0].AlsoPastedBy, []string{"CALM-FOX"}) {
+		t.Errorf("Expected paste to be also pasted by CALM-FOX, got %v", pastes[0].AlsoPastedBy)
+	}
+
+	// Other networks, one-time pastes and pastes outside of the window are not deduplicated
+	if other, _ := manager.InsertPaste(Paste{Network: "other-network", Content: "https://example.com", CreatedAt: time.Now()}); other == id {
+		t.Errorf("Expected paste of another network not to be deduplicated")
+	}
+	if oneTime, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "https://example.com", OneTime: true, CreatedAt: time.Now()}); oneTime == id {
+		t.Errorf("Expected one-time paste not to be deduplicated")
+	}
+	if later, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "https://example.com", CreatedAt: time.Now().Add(time.Hour)}); later == id {
+		t.Errorf("Expected paste outside of the window not to be deduplicated")
+	}
+}
+
+func TestDedupConcurrent(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := manager.InsertPaste(Paste{Network: "test-network", Content: "https://example.com", CreatedAt: time.Now()}); err != nil {
+				t.Errorf("Failed to insert paste: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if pastes, _ := manager.GetPastes("test-network"); len(pastes) != 1 {
+		t.Errorf("Expected identical concurrent pastes to be inserted once, got %v", pastes)
+	}
+}
+
+func TestDedupUnhashedPastes(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "https://example.com", CreatedAt: time.Now()})
+	// Pastes stored before pastes were hashed have no hash
+	manager.db.Exec("UPDATE pastes SET content_hash = ''")
+	manager.Close()
+
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatalf("Failed to reopen Manager: %v", err)
+	}
+	defer manager.Close()
+
+	if dup, err := manager.InsertPaste(Paste{Network: "test-network", Content: "https://example.com", CreatedAt: time.Now()}); err != nil || dup != id {
+		t.Errorf("Expected paste stored without a hash to be bumped, got %v %v", dup, err)
+	}
+}
+
+func TestDedupSettings(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+	t.Setenv("DEDUP_WINDOW", "0")
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	if s, err := manager.GetSettings("test-network"); err != nil || s != DefaultSettings {
+		t.Errorf("Expected default settings, got %+v %v", s, err)
+	}
+
+	// DEDUP_WINDOW=0 turns deduplication off by default
+	first, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "hello", CreatedAt: time.Now()})
+	if second, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "hello", CreatedAt: time.Now()}); second == first {
+		t.Errorf("Expected deduplication to be off with DEDUP_WINDOW=0")
+	}
+
+	// A network can set its own window
+	if err := manager.SaveSettings("test-network", Settings{Dedup: true, DedupWindow: time.Hour}); err != nil {
+		t.Fatalf("Failed to save settings: %v", err)
+	}
+	if s, _ := manager.GetSettings("test-network"); s.DedupWindow != time.Hour {
+		t.Errorf("Expected saved window, got %+v", s)
+	}
+	first, _ = manager.InsertPaste(Paste{Network: "test-network", Content: "world", CreatedAt: time.Now()})
+	if second, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "world", CreatedAt: time.Now()}); second != first {
+		t.Errorf("Expected paste to be deduplicated with the network window")
+	}
+
+	// Or turn deduplication off
+	manager.SaveSettings("test-network", Settings{Dedup: false, DedupWindow: time.Hour})
+	if second, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "world", CreatedAt: time.Now()}); second == first {
+		t.Errorf("Expected deduplication to be off for the network")
+	}
+}
+
+func TestDedupEncrypted(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	key, _ := GenerateKey()
+	t.Setenv("DB_KEY", key)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "hello", CreatedAt: time.Now()})
+
+	var hash string
+	manager.db.QueryRow("SELECT content_hash FROM pastes WHERE id = ?", id).Scan(&hash)
+	if hash == (*rowCipher)(nil).hash("hello") {
+		t.Errorf("Expected content hash to be keyed when encrypted at rest")
+	}
+
+	newKey, _ := GenerateKey()
+	master, _ := ParseKey(newKey)
+	if err := manager.RotateKey(master); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	if dup, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "hello", CreatedAt: time.Now()}); dup != id {
+		t.Errorf("Expected paste to be deduplicated after key rotation, got %v", dup)
+	}
+}
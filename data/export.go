@@ -0,0 +1,482 @@
+package data
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kuiadev/pastytext/media"
+)
+
+// Export formats. Zip exports hold a JSON export named pastes.json and the files of
+// attachments, the other formats only describe attachments.
+const (
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatMarkdown = "markdown"
+	FormatZip      = "zip"
+)
+
+// Formats lists every export format.
+var Formats = []string{FormatJSON, FormatNDJSON, FormatMarkdown, FormatZip}
+
+// zipManifest is the name of the JSON export in zip exports.
+const zipManifest = "pastes.json"
+
+// MaxZipSize is the largest total uncompressed size of the files in a zip export that
+// is imported.
+const MaxZipSize = 256 << 20
+
+// ErrUnknownFormat is returned when exporting or importing an unknown format.
+var ErrUnknownFormat = fmt.Errorf("unknown format, expected one of %v", Formats)
+
+// errZipTooLarge is returned for zip exports whose files are larger than MaxZipSize.
+var errZipTooLarge = fmt.Errorf("files are larger than %d bytes uncompressed", MaxZipSize)
+
+// FileCheck checks the file of an imported attachment and returns the name and file to
+// store, which may differ from those in the export. Attachments it fails are skipped.
+type FileCheck func(name string, file []byte) (string, []byte, error)
+
+// Record is a paste in exports.
+type Record struct {
+	CreatedAt  time.Time   `json:"created_at"`
+	User       string      `json:"user"`
+	Device     string      `json:"device"`
+	Content    string      `json:"content"`
+	Encryption string      `json:"encryption,omitempty"`
+	Pinned     bool        `json:"pinned,omitempty"`
+	Tags       []string    `json:"tags,omitempty"`
+	Attachment *RecordFile `json:"attachment,omitempty"`
+	// ReplyTo is the number, counting from 1, of the record a reply replies to.
+	ReplyTo int `json:"reply_to,omitempty"`
+	// Collection is the name of the collection the paste is in.
+	Collection string `json:"collection,omitempty"`
+}
+
+// RecordFile describes the file of an attachment in exports. Path is the name of the
+// file in zip exports.
+type RecordFile struct {
+	Name string `json:"name"`
+	Mime string `json:"mime"`
+	Size int64  `json:"size"`
+	Path string `json:"path,omitempty"`
+}
+
+// Export writes the pastes of the network to w in the given format, oldest first with
+// replies after the top-level pastes.
+// One-time pastes are left out as exporting would read them without consuming them.
+func (m *Manager) Export(w io.Writer, network, format string) error {
+	if !slices.Contains(Formats, format) {
+		return ErrUnknownFormat
+	}
+
+	top, err := m.GetPastes(network)
+	if err != nil {
+		return err
+	}
+	collections, err := m.Collections(network)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(collections))
+	for _, c := range collections {
+		names[c.Id] = c.Name
+	}
+
+	var pastes []Paste
+	for _, p := range top {
+		pastes = append(append(pastes, p), p.Replies...)
+	}
+	// Replies come after every top-level paste, as pasting a duplicate again moves its
+	// time past the replies it got
+	slices.SortStableFunc(pastes, func(a, b Paste) int {
+		if (a.ParentId == 0) != (b.ParentId == 0) {
+			if a.ParentId == 0 {
+				return -1
+			}
+			return 1
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	var records []Record
+	var exported []Paste
+	numbers := make(map[int64]int)
+	for _, p := range pastes {
+		if p.OneTime {
+			continue
+		}
+		r := Record{CreatedAt: p.CreatedAt, User: p.User, Device: p.Device, Content: p.Content, Encryption: p.Encryption, Pinned: p.Pinned, Tags: p.Tags,
+			ReplyTo: numbers[p.ParentId], Collection: names[p.CollectionId]}
+		if a := p.Attachment; a != nil {
+			r.Content = ""
+			r.Attachment = &RecordFile{Name: a.Name, Mime: a.Mime, Size: a.Size}
+		}
+		records = append(records, r)
+		exported = append(exported, p)
+		numbers[p.Id] = len(records)
+	}
+
+	switch format {
+	case FormatJSON:
+		return writeJSONRecords(w, records)
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatMarkdown:
+		return writeMarkdown(w, network, records)
+	default:
+		return m.writeZip(w, network, records, exported)
+	}
+}
+
+func writeJSONRecords(w io.Writer, records []Record) error {
+	if records == nil {
+		records = []Record{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// writeZip writes a zip of the JSON export and the files of attachments.
+func (m *Manager) writeZip(w io.Writer, network string, records []Record, pastes []Paste) error {
+	zw := zip.NewWriter(w)
+	for i, p := range pastes {
+		if p.Attachment == nil {
+			continue
+		}
+		_, file, err := m.GetAttachment(p.Attachment.Id, network)
+		if err != nil {
+			return err
+		}
+		records[i].Attachment.Path = fmt.Sprintf("files/%d-%s", i+1, path.Base(p.Attachment.Name))
+		fw, err := zw.Create(records[i].Attachment.Path)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(file); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.Create(zipManifest)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONRecords(fw, records); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Markdown exports list each paste under a heading with its time, user and device, then
+// optional "- key: value" lines and the content in a code fence longer than any run of
+// backticks in it, so that they can be read back.
+func writeMarkdown(w io.Writer, network string, records []Record) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Pastes of %s\n", network)
+	for _, r := range records {
+		fmt.Fprintf(bw, "\n## %s · %s · %s\n\n", r.CreatedAt.Format(time.RFC3339Nano), r.User, r.Device)
+		if r.Encryption != "" {
+			fmt.Fprintf(bw, "- encryption: %s\n", r.Encryption)
+		}
+		if r.Pinned {
+			fmt.Fprintf(bw, "- pinned: true\n")
+		}
+		if len(r.Tags) > 0 {
+			fmt.Fprintf(bw, "- tags: %s\n", strings.Join(r.Tags, " "))
+		}
+		if r.ReplyTo != 0 {
+			fmt.Fprintf(bw, "- reply to: %d\n", r.ReplyTo)
+		}
+		if r.Collection != "" {
+			fmt.Fprintf(bw, "- collection: %s\n", r.Collection)
+		}
+		if r.Attachment != nil {
+			fmt.Fprintf(bw, "- attachment: %s (%s, %d bytes)\n", r.Attachment.Name, r.Attachment.Mime, r.Attachment.Size)
+			continue
+		}
+		fence := strings.Repeat("`", max(3, longestRun(r.Content, '`')+1))
+		fmt.Fprintf(bw, "\n%s\n%s\n%s\n", fence, r.Content, fence)
+	}
+	return bw.Flush()
+}
+
+func longestRun(s string, c rune) int {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// DetectFormat guesses the format of an export from its first bytes.
+func DetectFormat(b []byte) string {
+	trimmed := bytes.TrimSpace(b)
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")):
+		return FormatZip
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return FormatJSON
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatNDJSON
+	case bytes.HasPrefix(trimmed, []byte("#")):
+		return FormatMarkdown
+	}
+	return ""
+}
+
+// Import adds the pastes of an export in the given format to the network, keeping their
+// times, users, devices and tags, in a single transaction. Attachments are only imported
+// from zip exports, which hold their files, and pass through check unless it is nil. It
+// returns the number of imported pastes.
+func (m *Manager) Import(b []byte, network, format string, check FileCheck) (int, error) {
+	var records []Record
+	files := make(map[string][]byte)
+	var err error
+
+	switch format {
+	case FormatJSON:
+		err = json.Unmarshal(b, &records)
+	case FormatNDJSON:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		for {
+			var r Record
+			if err = dec.Decode(&r); err != nil {
+				break
+			}
+			records = append(records, r)
+		}
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case FormatMarkdown:
+		records, err = readMarkdown(b)
+	case FormatZip:
+		records, err = readZip(b, files)
+	default:
+		return 0, ErrUnknownFormat
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s export: %w", format, err)
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// ids holds the ID each record was imported as, 0 if it was skipped
+	ids := make([]int64, len(records))
+	imported := 0
+	for i, r := range records {
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = time.Now()
+		}
+		p := Paste{Network: network, CreatedAt: r.CreatedAt, User: r.User, Device: r.Device, Content: r.Content, Encryption: r.Encryption}
+		if r.ReplyTo > 0 && r.ReplyTo <= i {
+			p.ParentId = ids[r.ReplyTo-1]
+		}
+
+		var id int64
+		if r.Attachment != nil {
+			file, ok := files[r.Attachment.Path]
+			if r.Attachment.Path == "" || !ok {
+				continue
+			}
+			name := r.Attachment.Name
+			if check != nil {
+				if name, file, err = check(name, file); err != nil {
+					continue
+				}
+			}
+			p.Attachment = &Attachment{Name: name, Mime: http.DetectContentType(file)}
+			var thumbnail []byte
+			if p.Attachment.Image() {
+				thumbnail, _ = media.Thumbnail(file)
+			}
+			if p, err = m.insertAttachment(tx, p, file, thumbnail); err != nil {
+				return 0, err
+			}
+			id = p.Id
+		} else if id, err = m.insertPaste(tx, p); err != nil {
+			return 0, err
+		}
+
+		// Pastes beyond MAX_PINS and replies are imported unpinned
+		if r.Pinned {
+			err := m.pin(tx, id, network, true)
+			if err != nil && !errors.Is(err, ErrTooManyPins) && !errors.Is(err, sql.ErrNoRows) {
+				return 0, err
+			}
+		}
+		if name, err := normalizeCollectionName(r.Collection); err == nil && p.ParentId == 0 {
+			if err := importCollection(tx, id, network, name); err != nil {
+				return 0, err
+			}
+		}
+
+		// Hashtags were tagged on insert, the other tags were set by users
+		var tags []string
+		for _, t := range r.Tags {
+			if tag, err := NormalizeTag(t); err == nil {
+				tags = append(tags, tag)
+			}
+		}
+		if err := addTags(tx, id, tags, true); err != nil {
+			return 0, err
+		}
+		ids[i] = id
+		imported++
+	}
+
+	return imported, tx.Commit()
+}
+
+// importCollection moves an imported paste into the collection of the network with
+// that name, creating it if the network has none.
+func importCollection(tx *sql.Tx, id int64, network, name string) error {
+	var collectionID int64
+	err := tx.QueryRow("SELECT id FROM collections WHERE network = ? AND name = ?", network, name).Scan(&collectionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow("INSERT INTO collections (network, name, created_at) VALUES (?, ?, ?) RETURNING id", network, name, time.Now()).Scan(&collectionID)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE pastes SET collection_id = ? WHERE id = ?", collectionID, id)
+	return err
+}
+
+// readZip reads the records of a zip export and the files of its attachments, up to
+// MaxZipSize in total.
+func readZip(b []byte, files map[string][]byte) ([]Record, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	var total uint64
+	for _, f := range zr.File {
+		if total += f.UncompressedSize64; total > MaxZipSize {
+			return nil, errZipTooLarge
+		}
+	}
+
+	var records []Record
+	found := false
+	left := int64(MaxZipSize)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, left+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if left -= int64(len(content)); left < 0 {
+			return nil, errZipTooLarge
+		}
+
+		if f.Name == zipManifest {
+			if err := json.Unmarshal(content, &records); err != nil {
+				return nil, err
+			}
+			found = true
+			continue
+		}
+		files[f.Name] = content
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is missing", zipManifest)
+	}
+	return records, nil
+}
+
+// readMarkdown reads the records written by writeMarkdown.
+func readMarkdown(b []byte) ([]Record, error) {
+	lines := strings.Split(string(b), "\n")
+
+	var records []Record
+	for i := 0; i < len(lines); i++ {
+		heading, ok := strings.CutPrefix(lines[i], "## ")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(heading, " · ")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: expected a heading with time, user and device", i+1)
+		}
+		created, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		r := Record{CreatedAt: created, User: parts[1], Device: parts[2]}
+
+		// Metadata lines until the code fence or the next paste
+		for i+1 < len(lines) && !strings.HasPrefix(lines[i+1], "```") && !strings.HasPrefix(lines[i+1], "## ") {
+			i++
+			key, value, _ := strings.Cut(strings.TrimPrefix(lines[i], "- "), ": ")
+			switch key {
+			case "encryption":
+				r.Encryption = value
+			case "pinned":
+				r.Pinned = value == "true"
+			case "tags":
+				r.Tags = strings.Fields(value)
+			case "reply to":
+				if r.ReplyTo, err = strconv.Atoi(value); err != nil {
+					return nil, fmt.Errorf("line %d: %w", i+1, err)
+				}
+			case "collection":
+				r.Collection = value
+			case "attachment":
+				r.Attachment = &RecordFile{Name: value}
+			}
+		}
+		if r.Attachment != nil {
+			records = append(records, r)
+			continue
+		}
+
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "```") {
+			return nil, fmt.Errorf("line %d: expected the content in a code fence", i+2)
+		}
+		i++
+		fence := strings.TrimRight(lines[i], "\r")
+		start := i + 1
+		for i++; i < len(lines) && strings.TrimRight(lines[i], "\r") != fence; i++ {
+		}
+		if i >= len(lines) {
+			return nil, fmt.Errorf("line %d: code fence is not closed", start)
+		}
+		r.Content = strings.Join(lines[start:i], "\n")
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	created := time.Date(2024, 3, 1, 9, 30, 15, 123456789, time.UTC)
+	contents := []string{
+		"https://example.com",
+		"package main\n\nfunc main() {}\n",
+		"a fence in the paste:\n```\ncode\n```",
+		"## not a heading",
+		"deploy with make #release",
+	}
+	var ids []int64
+	for i, content := range contents {
+		id, _ := manager.InsertPaste(Paste{Network: "source", User: "BRAVE-OTTER", Device: "Linux-Firefox", Content: content, CreatedAt: created.Add(time.Duration(i) * time.Minute)})
+		ids = append(ids, id)
+	}
+	configs, _ := manager.CreateCollection("source", "deploy configs")
+	manager.MovePaste(ids[1], "source", configs.Id)
+	pinned, _ := manager.InsertPaste(Paste{Network: "source", User: "CALM-FOX", Device: "iOS-Safari", Content: "v1:AAAA:BBBB", Encryption: EncryptionE2E, CreatedAt: created.Add(time.Hour)})
+	manager.PinPaste(pinned, "source", true)
+	manager.SetTags(pinned, "source", []string{"keys"})
+	manager.InsertPaste(Paste{Network: "source", Content: "read me once", OneTime: true, CreatedAt: created})
+
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		if err := manager.Export(&buf, "source", format); err != nil {
+			t.Fatalf("Failed to export %v: %v", format, err)
+		}
+		if got := DetectFormat(buf.Bytes()); got != format {
+			t.Errorf("Expected %v export to be detected, got %q", format, got)
+		}
+
+		target := "target-" + format
+		n, err := manager.Import(buf.Bytes(), target, format, nil)
+		if err != nil || n != len(contents)+1 {
+			t.Fatalf("Expected %v pastes imported from %v, got %v %v", len(contents)+1, format, n, err)
+		}
+
+		want, _ := manager.GetPastes("source")
+		got, _ := manager.GetPastes(target)
+		if len(got) != len(want)-1 {
+			t.Fatalf("Expected every paste but the one-time one in %v, got %v", format, got)
+		}
+		for i, w := range want[:len(want)-1] {
+			g := got[i]
+			if g.Content != w.Content || !g.CreatedAt.Equal(w.CreatedAt) || g.User != w.User || g.Device != w.Device ||
+				g.Encryption != w.Encryption || g.Pinned != w.Pinned || g.Type != w.Type || !slices.Equal(g.Tags, w.Tags) ||
+				(g.CollectionId == 0) != (w.CollectionId == 0) {
+				t.Errorf("%v: expected %+v, got %+v", format, w, g)
+			}
+		}
+		if collections, _ := manager.Collections(target); len(collections) != 1 || collections[0].Name != "deploy configs" || collections[0].Count != 1 {
+			t.Errorf("%v: expected the collection to be imported, got %v", format, collections)
+		}
+	}
+
+	if err := manager.Export(&bytes.Buffer{}, "source", "xml"); err != ErrUnknownFormat {
+		t.Errorf("Expected unknown format to be refused, got %v", err)
+	}
+	if _, err := manager.Import([]byte("## nonsense"), "target", FormatMarkdown, nil); err == nil {
+		t.Errorf("Expected malformed markdown to be refused")
+	}
+	if _, err := manager.Import([]byte(`[{"content": "ok"}, {"content": 1}]`), "broken", FormatJSON, nil); err == nil {
+		t.Errorf("Expected malformed JSON to be refused")
+	}
+	if pastes, _ := manager.GetPastes("broken"); len(pastes) != 0 {
+		t.Errorf("Expected nothing imported from a malformed export, got %v", pastes)
+	}
+}
+
+func TestExportImportAttachments(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	manager.InsertAttachment(Paste{Network: "source", User: "BRAVE-OTTER", CreatedAt: time.Now(), Attachment: &Attachment{Name: "dot.png", Mime: "image/png"}}, img.Bytes(), nil)
+	manager.InsertPaste(Paste{Network: "source", Content: "text", CreatedAt: time.Now()})
+
+	var zipped, plain bytes.Buffer
+	manager.Export(&zipped, "source", FormatZip)
+	manager.Export(&plain, "source", FormatJSON)
+
+	// Only zip exports hold the files of attachments
+	if n, err := manager.Import(plain.Bytes(), "from-json", FormatJSON, nil); err != nil || n != 1 {
+		t.Errorf("Expected attachments without files to be skipped, got %v %v", n, err)
+	}
+
+	if n, err := manager.Import(zipped.Bytes(), "from-zip", FormatZip, nil); err != nil || n != 2 {
+		t.Fatalf("Expected 2 pastes imported from zip, got %v %v", n, err)
+	}
+	pastes, _ := manager.GetPastes("from-zip")
+	var a *Attachment
+	for _, p := range pastes {
+		if p.Attachment != nil {
+			a = p.Attachment
+		}
+	}
+	if a == nil || a.Name != "dot.png" || a.Mime != "image/png" || !a.Thumbnail {
+		t.Fatalf("Expected imported image with a thumbnail, got %+v", a)
+	}
+	_, file, err := manager.GetAttachment(a.Id, "from-zip")
+	if err != nil || !bytes.Equal(file, img.Bytes()) {
+		t.Errorf("Expected imported file to match, got %v", err)
+	}
+}
+
+func TestImportZipBomb(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	// The file is not read when the headers already tell it is too large
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateRaw(&zip.FileHeader{Name: "files/1", Method: zip.Deflate, CompressedSize64: 2, UncompressedSize64: MaxZipSize + 1})
+	w.Write([]byte{3, 0})
+	w, _ = zw.Create(zipManifest)
+	w.Write([]byte("[]"))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	if _, err := manager.Import(buf.Bytes(), "bomb", FormatZip, nil); err == nil || !strings.Contains(err.Error(), "uncompressed") {
+		t.Errorf("Expected the zip to be rejected as too large, got %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package data
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/kuiadev/pastytext/detect"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -18,10 +21,92 @@ const create = `CREATE TABLE IF NOT EXISTS pastes (
 	content TEXT
 );`
 
+// migrations bring an existing database up to date. They are applied in order and
+// the number of applied migrations is stored in the user_version pragma, so new
+// migrations must only ever be appended.
+var migrations = []string{
+	`ALTER TABLE pastes ADD COLUMN encryption TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pastes ADD COLUMN key_id INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE pastes ADD COLUMN secret TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pastes ADD COLUMN one_time INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE pastes ADD COLUMN type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pastes ADD COLUMN language TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pastes ADD COLUMN attachment_id INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE pastes ADD COLUMN attachment_mime TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pastes ADD COLUMN attachment_size INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE pastes ADD COLUMN attachment_thumbnail INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TRIGGER delete_paste_attachment AFTER DELETE ON pastes WHEN OLD.attachment_id != 0
+	BEGIN
+		DELETE FROM attachments WHERE id = OLD.attachment_id;
+	END`,
+	`ALTER TABLE pastes ADD COLUMN content_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pastes ADD COLUMN also_pasted_by TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX pastes_network_hash ON pastes (network, content_hash)`,
+	`ALTER TABLE pastes ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE pastes ADD COLUMN edited_at DATETIME`,
+	`ALTER TABLE pastes ADD COLUMN edited_by TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX paste_versions_paste ON paste_versions (paste_id, version)`,
+	`CREATE TRIGGER delete_paste_versions AFTER DELETE ON pastes
+	BEGIN
+		DELETE FROM paste_versions WHERE paste_id = OLD.id;
+	END`,
+	`ALTER TABLE pastes ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE pastes ADD COLUMN deleted_at DATETIME`,
+	`ALTER TABLE pastes ADD COLUMN deleted_by TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX paste_tags_tag ON paste_tags (tag)`,
+	`CREATE TRIGGER delete_paste_tags AFTER DELETE ON pastes
+	BEGIN
+		DELETE FROM paste_tags WHERE paste_id = OLD.id;
+	END`,
+	`ALTER TABLE pastes ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX pastes_parent ON pastes (parent_id)`,
+	`CREATE TRIGGER delete_paste_replies AFTER DELETE ON pastes WHEN OLD.parent_id = 0
+	BEGIN
+		DELETE FROM pastes WHERE parent_id = OLD.id;
+	END`,
+	`CREATE TRIGGER delete_paste_reactions AFTER DELETE ON pastes
+	BEGIN
+		DELETE FROM paste_reactions WHERE paste_id = OLD.id;
+	END`,
+	`ALTER TABLE pastes ADD COLUMN collection_id INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX pastes_collection ON pastes (collection_id)`,
+	`CREATE TRIGGER delete_collection_pastes AFTER DELETE ON collections
+	BEGIN
+		UPDATE pastes SET collection_id = 0 WHERE collection_id = OLD.id;
+	END`,
+	`ALTER TABLE pastes ADD COLUMN author TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE scheduled_pastes ADD COLUMN author TEXT NOT NULL DEFAULT ''`,
+}
+
+// reactionsColumn selects the reactions to a paste as a JSON array of emoji and user
+// pairs, oldest first.
+const reactionsColumn = "(SELECT json_group_array(json_array(emoji, user) ORDER BY created_at, rowid) FROM paste_reactions WHERE paste_id = pastes.id)"
+
+// pasteColumns are the columns read by scanPaste, in order.
+const pasteColumns = "id, created_at, network, user, device, content, encryption, key_id, secret, one_time, type, language, attachment_id, attachment_mime, attachment_size, attachment_thumbnail, also_pasted_by, version, edited_at, edited_by, pinned, deleted_at, deleted_by, " +
+	"(SELECT group_concat(tag, ' ' ORDER BY tag) FROM paste_tags WHERE paste_id = pastes.id), parent_id, " + reactionsColumn + ", collection_id, author"
+
 const defaultDbFile string = "../dbdata/pastytext.db"
 
+// EncryptionE2E marks a paste whose content was encrypted by the client with a
+// room secret the server never sees.
+const EncryptionE2E = "e2e-v1"
+
 type Manager struct {
 	db *sql.DB
+
+	// cipher encrypts paste contents at rest, it is nil when no key is configured.
+	cipher *rowCipher
+
+	// dedupWindow is the default window in which identical pastes are bumped.
+	dedupWindow time.Duration
+
+	// maxPins is the number of pastes a network can pin.
+	maxPins int
+
+	// insertMu serializes InsertPaste, so that the duplicate check of a paste sees the
+	// pastes inserted right before it.
+	insertMu sync.Mutex
 }
 
 // Paste is a struct that represents a paste.
@@ -32,48 +117,225 @@ type Paste struct {
 	User      string
 	Device    string
 	Content   string
+
+	// Encryption is empty for plain text pastes, otherwise it names the
+	// scheme the client used to encrypt Content.
+	Encryption string
+
+	// Secret is the kind of secret detected in Content when it was inserted,
+	// empty if none was found.
+	Secret detect.Kind
+
+	// OneTime pastes are deleted as soon as they are consumed.
+	OneTime bool
+
+	// Type is the kind of content and Language the guessed programming language of
+	// code. Both are empty for end-to-end encrypted pastes.
+	Type     detect.ContentType
+	Language string
+
+	// Attachment describes the file of the paste, nil for text pastes.
+	Attachment *Attachment
+
+	// AlsoPastedBy lists the other users that pasted the same content.
+	AlsoPastedBy []string
+
+	// Version counts the edits of the paste, starting at 1. EditedAt and EditedBy
+	// tell when and by whom it was last edited, EditedAt is nil if it never was.
+	Version  int
+	EditedAt *time.Time
+	EditedBy string
+
+	// Pinned pastes are listed first and kept by automatic cleanups.
+	Pinned bool
+
+	// DeletedAt and DeletedBy tell when and by whom a paste was moved to the trash,
+	// DeletedAt is nil for pastes that are not in the trash.
+	DeletedAt *time.Time
+	DeletedBy string
+
+	// Tags are the hashtags found in the content and the tags set by users, sorted.
+	Tags []string
+
+	// ParentId is the paste a reply replies to, 0 for other pastes. Replies are only
+	// listed in the Replies of their parent, oldest first.
+	ParentId int64
+	Replies  []Paste
+
+	// Reactions are the emoji reactions to the paste.
+	Reactions []Reaction
+
+	// CollectionId is the collection of the network the paste was moved into, 0 if none.
+	CollectionId int64
+
+	// Author is the device ID the server issued to the device that pasted it, empty for
+	// pastes of the API. Unlike User and Device it cannot be chosen by the device, and it
+	// is never sent to clients.
+	Author string `json:"-"`
+}
+
+// Encrypted reports whether the content is ciphertext only clients can read.
+// The server must not inspect, index or classify the content of such pastes.
+func (p Paste) Encrypted() bool {
+	return p.Encryption != ""
 }
 
+// NewManager opens the database in DB_FILE. When a key is given in DB_KEY or DB_KEY_FILE
+// paste contents are encrypted at rest, and an encrypted database fails to open without it.
 func NewManager() (*Manager, error) {
+	master, err := masterKey()
+	if err != nil {
+		return nil, fmt.Errorf("invalid database key: %w", err)
+	}
+
+	dbFile, err := dbPath()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []string{create, createPassphrases, createBans, createKeys, createAttachments, createSettings, createVersions, createTags, createReactions, createCollections, createScheduled} {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{db: db, dedupWindow: newDedupWindow(), maxPins: newMaxPins()}
+	if err := m.setupEncryption(master); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := m.classifyPastes(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := m.hashPastes(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// dbPath returns the database file from DB_FILE, creating the directory of the
+// default file when it is not set.
+func dbPath() (string, error) {
 	dbFile := os.Getenv("DB_FILE")
 	if dbFile == "" {
 		dbFile = defaultDbFile
 
 		err := os.Mkdir("../dbdata", 0750)
 		if err != nil && !os.IsExist(err) {
-			return nil, err
+			return "", err
 		}
 	}
+	return dbFile, nil
+}
 
-	db, err := sql.Open("sqlite3", dbFile)
+// migrate applies the migrations the database has not seen yet.
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer tx.Rollback()
 
-	if _, err := db.Exec(create); err != nil {
-		return nil, err
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version >= len(migrations) {
+		return nil
+	}
+
+	for _, stmt := range migrations[version:] {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations))); err != nil {
+		return err
 	}
 
-	return &Manager{db: db}, nil
+	return tx.Commit()
 }
 
 func (m *Manager) Close() error {
 	return m.db.Close()
 }
 
-// InsertPaste inserts a paste into the database.
+// InsertPaste inserts a paste into the database. Unless the paste is end-to-end
+// encrypted, its content is classified. When the network pasted the same content
+// recently, that paste is bumped to the top instead and its ID returned.
 func (m *Manager) InsertPaste(p Paste) (int64, error) {
-	res, err := m.db.Exec("INSERT INTO pastes (created_at, network, user, device, content) VALUES (?, ?, ?, ?, ?)", p.CreatedAt, p.Network, p.User, p.Device, p.Content)
+	m.insertMu.Lock()
+	defer m.insertMu.Unlock()
+
+	tx, err := m.db.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	return res.LastInsertId()
+	id, ok, err := m.bumpDuplicate(tx, p)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		if id, err = m.insertPaste(tx, p); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
 }
 
-// GetPastes returns all pastes from the database.
+// insertPaste inserts a paste and its tags with the given connection or transaction.
+func (m *Manager) insertPaste(db execer, p Paste) (int64, error) {
+	classify(&p)
+
+	content, keyID, err := m.cipher.encrypt(p.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	var attachment Attachment
+	if p.Attachment != nil {
+		attachment = *p.Attachment
+	}
+
+	res, err := db.Exec(`INSERT INTO pastes (created_at, network, user, device, content, encryption, key_id, secret, one_time, type, language,
+		attachment_id, attachment_mime, attachment_size, attachment_thumbnail, content_hash, parent_id, author) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.CreatedAt, p.Network, p.User, p.Device, content, p.Encryption, keyID, p.Secret, p.OneTime, p.Type, p.Language,
+		attachment.Id, attachment.Mime, attachment.Size, attachment.Thumbnail, m.cipher.hash(p.Content), p.ParentId, p.Author)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, m.tagContent(db, id, p)
+}
+
+// GetPastes returns all pastes of the network, pinned pastes first and then newest first.
 func (m *Manager) GetPastes(network string) ([]Paste, error) {
-	rows, err := m.db.Query("SELECT id, created_at, network, user, device, content FROM pastes WHERE network = ? ORDER BY created_at DESC", network)
+	return m.FindPastes(network, PasteFilter{})
+}
+
+// FindPastes returns the pastes of the network matching the filter, pinned pastes first
+// and then newest first. Replies are not listed themselves but in their parent.
+func (m *Manager) FindPastes(network string, f PasteFilter) ([]Paste, error) {
+	where, args := f.where()
+	rows, err := m.db.Query("SELECT "+pasteColumns+" FROM pastes WHERE network = ? AND parent_id = 0 AND deleted_at IS NULL"+where+" ORDER BY pinned DESC, created_at DESC", append([]any{network}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,18 +343,98 @@ func (m *Manager) GetPastes(network string) ([]Paste, error) {
 
 	var pastes []Paste
 	for rows.Next() {
-		var p Paste
-		if err := rows.Scan(&p.Id, &p.CreatedAt, &p.Network, &p.User, &p.Device, &p.Content); err != nil {
+		p, err := m.scanPaste(rows)
+		if err != nil {
 			return nil, err
 		}
 		pastes = append(pastes, p)
 	}
+	rows.Close()
 
+	if err := m.addReplies(network, pastes); err != nil {
+		return nil, err
+	}
 	return pastes, nil
 }
 
-// DeletePaste deletes a paste from the database based on its ID.
+// GetPaste returns a single paste by its ID. Pastes in the trash are not returned.
+func (m *Manager) GetPaste(id int64) (Paste, error) {
+	return m.scanPaste(m.db.QueryRow("SELECT "+pasteColumns+" FROM pastes WHERE id = ? AND deleted_at IS NULL", id))
+}
+
+// scanPaste reads a row selected with pasteColumns and decrypts its content.
+func (m *Manager) scanPaste(row interface{ Scan(...any) error }) (Paste, error) {
+	var p Paste
+	var keyID int64
+	var a Attachment
+	var also string
+	var editedAt, deletedAt sql.NullTime
+	var tags, reactions sql.NullString
+	if err := row.Scan(&p.Id, &p.CreatedAt, &p.Network, &p.User, &p.Device, &p.Content, &p.Encryption, &keyID, &p.Secret, &p.OneTime, &p.Type, &p.Language,
+		&a.Id, &a.Mime, &a.Size, &a.Thumbnail, &also, &p.Version, &editedAt, &p.EditedBy, &p.Pinned, &deletedAt, &p.DeletedBy, &tags, &p.ParentId, &reactions, &p.CollectionId, &p.Author); err != nil {
+		return p, err
+	}
+	p.AlsoPastedBy = parseAlsoPastedBy(also)
+	p.Tags = parseTags(tags)
+	p.Reactions = parseReactions(reactions)
+	if editedAt.Valid {
+		p.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		p.DeletedAt = &deletedAt.Time
+	}
+
+	var err error
+	p.Content, err = m.decrypt(p.Content, keyID)
+	if a.Id != 0 {
+		a.Name = p.Content
+		p.Attachment = &a
+	}
+	return p, err
+}
+
+// ConsumePaste deletes a one-time paste of the network and returns it. It returns
+// sql.ErrNoRows if there is no such paste, including when it was already consumed.
+func (m *Manager) ConsumePaste(id int64, network string) (Paste, error) {
+	return m.scanPaste(m.db.QueryRow("DELETE FROM pastes WHERE id = ? AND network = ? AND one_time = 1 AND deleted_at IS NULL RETURNING "+pasteColumns, id, network))
+}
+
+// DeletePaste deletes a paste from the database based on its ID right away, without
+// moving it to the trash.
 func (m *Manager) DeletePaste(id int64) error {
 	_, err := m.db.Exec("DELETE FROM pastes WHERE id = ?", id)
 	return err
 }
+
+// PurgePaste deletes a paste based on its ID right away, whether or not it is in the
+// trash, and returns the network it belonged to. It returns sql.ErrNoRows if there is
+// no such paste.
+func (m *Manager) PurgePaste(id int64) (string, error) {
+	var network string
+	err := m.db.QueryRow("DELETE FROM pastes WHERE id = ? RETURNING network", id).Scan(&network)
+	return network, err
+}
+
+// DeleteSecretsBefore deletes the pastes with a detected secret created before the given
+// time and returns the networks they belonged to. Pinned pastes are kept.
+func (m *Manager) DeleteSecretsBefore(before time.Time) ([]string, error) {
+	rows, err := m.db.Query("DELETE FROM pastes WHERE secret != '' AND pinned = 0 AND julianday(created_at) < julianday(?) RETURNING network", before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	var networks []string
+	for rows.Next() {
+		var network string
+		if err := rows.Scan(&network); err != nil {
+			return nil, err
+		}
+		if !seen[network] {
+			seen[network] = true
+			networks = append(networks, network)
+		}
+	}
+	return networks, rows.Err()
+}
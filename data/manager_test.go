@@ -1,9 +1,12 @@
 package data
 
 import (
+	"database/sql"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/kuiadev/pastytext/detect"
 )
 
 const testDbFile = "pastytext_test.db"
@@ -154,3 +157,168 @@ func teardownTest() {
 	os.Remove(testDbFile)
 	os.Setenv("DB_FILE", "")
 }
+
+func TestMigrate(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	// Create a database with the original schema and a paste in it
+	db, err := sql.Open("sqlite3", testDbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.Exec(create)
+	db.Exec("INSERT INTO pastes (created_at, network, user, device, content) VALUES (?, ?, ?, ?, ?)", time.Now(), "test-network", "test User", "test-device", "old paste")
+	db.Close()
+
+	for range 2 {
+		manager, err := NewManager()
+		if err != nil {
+			t.Fatalf("Failed to create new Manager: %v", err)
+		}
+
+		var version int
+		manager.db.QueryRow("PRAGMA user_version").Scan(&version)
+		if version != len(migrations) {
+			t.Errorf("Expected schema version %v, got %v", len(migrations), version)
+		}
+
+		pastes, err := manager.GetPastes("test-network")
+		if err != nil || len(pastes) != 1 || pastes[0].Content != "old paste" {
+			t.Errorf("Expected old paste to survive the migration, got %v %v", pastes, err)
+		}
+		if len(pastes) == 1 && pastes[0].Type != detect.TypeText {
+			t.Errorf("Expected old paste to be classified, got type %q", pastes[0].Type)
+		}
+		manager.Close()
+	}
+}
+
+func TestEncryptedPaste(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	_, err = manager.InsertPaste(Paste{Network: "test-network", Content: "v1:abc:def", Encryption: EncryptionE2E, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to insert new paste: %v", err)
+	}
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 1 || !pastes[0].Encrypted() || pastes[0].Encryption != EncryptionE2E {
+		t.Errorf("Expected encrypted paste to keep its encryption scheme, got %v", pastes)
+	}
+}
+
+func TestSecretPastes(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	old := time.Now().Add(-time.Hour)
+	manager.InsertPaste(Paste{Network: "test-network", Content: "Tr0ub4dor&3", CreatedAt: old})
+	manager.InsertPaste(Paste{Network: "test-network", Content: "just text", CreatedAt: old})
+	manager.InsertPaste(Paste{Network: "test-network", Content: "v1:AAAA:4111111111111111", Encryption: EncryptionE2E, CreatedAt: old})
+	manager.InsertPaste(Paste{Network: "other-network", Content: "4111 1111 1111 1111", CreatedAt: time.Now()})
+
+	pastes, _ := manager.GetPastes("test-network")
+	secrets := map[string]detect.Kind{}
+	for _, p := range pastes {
+		secrets[p.Content] = p.Secret
+	}
+	if secrets["Tr0ub4dor&3"] != detect.Password || secrets["just text"] != detect.None || secrets["v1:AAAA:4111111111111111"] != detect.None {
+		t.Errorf("Expected only the plain text password to be classified, got %v", secrets)
+	}
+
+	networks, err := manager.DeleteSecretsBefore(time.Now().Add(-time.Minute))
+	if err != nil || len(networks) != 1 || networks[0] != "test-network" {
+		t.Errorf("Expected expired secret of test-network to be deleted, got %v %v", networks, err)
+	}
+
+	pastes, _ = manager.GetPastes("test-network")
+	if len(pastes) != 2 {
+		t.Errorf("Expected 2 pastes left, got %v", len(pastes))
+	}
+	pastes, _ = manager.GetPastes("other-network")
+	if len(pastes) != 1 || pastes[0].Secret != detect.CreditCard {
+		t.Errorf("Expected recent secret to be kept, got %v", pastes)
+	}
+}
+
+func TestConsumePaste(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "wifi password", OneTime: true, CreatedAt: time.Now()})
+	regular, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "regular", CreatedAt: time.Now()})
+
+	if _, err := manager.ConsumePaste(id, "other-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected paste of another network not to be consumed, got %v", err)
+	}
+	if _, err := manager.ConsumePaste(regular, "test-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected regular paste not to be consumed, got %v", err)
+	}
+
+	paste, err := manager.ConsumePaste(id, "test-network")
+	if err != nil || paste.Content != "wifi password" || !paste.OneTime {
+		t.Errorf("Expected one-time paste to be returned, got %v %v", paste, err)
+	}
+	if _, err := manager.ConsumePaste(id, "test-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected paste to be consumed only once, got %v", err)
+	}
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 1 || pastes[0].Id != regular {
+		t.Errorf("Expected only the regular paste to be left, got %v", pastes)
+	}
+}
+
+func TestFindPastes(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	for _, content := range []string{"https://example.com", "package main\n\nfunc main() {}", "def main():\n    pass", "Tr0ub4dor&3"} {
+		manager.InsertPaste(Paste{Network: "test-network", Content: content, CreatedAt: time.Now()})
+	}
+	manager.InsertPaste(Paste{Network: "test-network", Content: "v1:AAAA:BBBB", Encryption: EncryptionE2E, CreatedAt: time.Now()})
+
+	tests := []struct {
+		filter PasteFilter
+		want   int
+	}{
+		{PasteFilter{}, 5},
+		{PasteFilter{Type: detect.TypeURL}, 1},
+		{PasteFilter{Type: detect.TypeCode}, 2},
+		{PasteFilter{Type: detect.TypeCode, Language: "go"}, 1},
+		{PasteFilter{Type: detect.TypeSecret}, 1},
+		{PasteFilter{Type: detect.TypeEmail}, 0},
+	}
+	for _, tt := range tests {
+		pastes, err := manager.FindPastes("test-network", tt.filter)
+		if err != nil || len(pastes) != tt.want {
+			t.Errorf("FindPastes(%+v) returned %v pastes, expected %v (%v)", tt.filter, len(pastes), tt.want, err)
+		}
+	}
+}
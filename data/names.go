@@ -1,10 +1,21 @@
 package data
 
 import (
+	"bufio"
+	"fmt"
 	"math/rand"
+	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
+// nameAttempts is the number of random pairs tried before a numeric suffix is used.
+const nameAttempts = 32
+
+// fallbackName is the base of generated names when every word is blocked.
+const fallbackName = "DEVICE"
+
 var adjectives = []string{
 	"able", "brave", "calm", "clean", "clear", "cold", "dark", "deep", "dry", "easy",
 	"elated", "fair", "fast", "fine", "free", "friendly", "good", "hard", "harsh", "heavy",
@@ -38,7 +49,221 @@ var nouns = []string{
 	"rose",
 }
 
+var defaultNames = NewNameGenerator(time.Now().UnixNano())
+
+// NameGenerator generates human-readable device names that are unique within a network.
+type NameGenerator struct {
+	mu         sync.Mutex
+	rnd        *rand.Rand
+	adjectives []string
+	nouns      []string
+	blocked    map[string]struct{}
+	taken      map[string]map[string]struct{}
+}
+
+// NewNameGenerator creates a name generator using the built-in word lists.
+// The same seed always produces the same sequence of names.
+func NewNameGenerator(seed int64) *NameGenerator {
+	return &NameGenerator{
+		rnd:        rand.New(rand.NewSource(seed)),
+		adjectives: adjectives,
+		nouns:      nouns,
+		blocked:    make(map[string]struct{}),
+		taken:      make(map[string]map[string]struct{}),
+	}
+}
+
+// LoadWords replaces the adjective and noun lists with the words found in the given files.
+// An empty path keeps the current list.
+func (g *NameGenerator) LoadWords(adjectiveFile, nounFile string) error {
+	var adj, noun []string
+	var err error
+
+	if adjectiveFile != "" {
+		if adj, err = readWordFile(adjectiveFile); err != nil {
+			return err
+		}
+	}
+	if nounFile != "" {
+		if noun, err = readWordFile(nounFile); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if adj != nil {
+		g.adjectives = adj
+	}
+	if noun != nil {
+		g.nouns = noun
+	}
+	return nil
+}
+
+// LoadBlocklist blocks every word listed in the given file.
+func (g *NameGenerator) LoadBlocklist(path string) error {
+	words, err := readWordFile(path)
+	if err != nil {
+		return err
+	}
+	g.Block(words...)
+	return nil
+}
+
+// Block prevents the given words from being used in generated names.
+func (g *NameGenerator) Block(words ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, w := range words {
+		g.blocked[strings.ToLower(strings.TrimSpace(w))] = struct{}{}
+	}
+}
+
+// Generate returns a name that is not currently taken on the network and reserves it.
+func (g *NameGenerator) Generate(network string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	name := g.available(network)
+	g.reserve(network, name)
+	return name
+}
+
+// Suggest returns a name that is not currently taken on the network without reserving it,
+// so it may be handed out again until a client claims it with Reserve.
+func (g *NameGenerator) Suggest(network string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.available(network)
+}
+
+// Reserve marks the name as taken on the network. It returns false if the name is already taken.
+func (g *NameGenerator) Reserve(network, name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.isTaken(network, name) {
+		return false
+	}
+	g.reserve(network, name)
+	return true
+}
+
+// Release frees a name so it can be handed out again on the network.
+func (g *NameGenerator) Release(network, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	names := g.taken[network]
+	delete(names, strings.ToUpper(name))
+	if len(names) == 0 {
+		delete(g.taken, network)
+	}
+}
+
+// IsBlocked reports whether any part of the name is a blocked word.
+func (g *NameGenerator) IsBlocked(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, part := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '-' || r == ' ' || r == '_' }) {
+		if _, ok := g.blocked[part]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// available returns a name that is not taken on the network. The caller must hold g.mu.
+func (g *NameGenerator) available(network string) string {
+	var name string
+	for range nameAttempts {
+		name = g.candidate()
+		if !g.isTaken(network, name) {
+			return name
+		}
+	}
+
+	// Every attempt collided, fall back to suffixing the last candidate
+	base := name
+	for i := 2; ; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+		if !g.isTaken(network, name) {
+			return name
+		}
+	}
+}
+
+// candidate picks a random adjective/noun pair, ignoring blocked words. If the blocklist
+// leaves no words to pick from, fallbackName is returned instead.
+func (g *NameGenerator) candidate() string {
+	adj := g.allowed(g.adjectives)
+	noun := g.allowed(g.nouns)
+	if len(adj) == 0 || len(noun) == 0 {
+		adj, noun = g.allowed(adjectives), g.allowed(nouns)
+	}
+	if len(adj) == 0 || len(noun) == 0 {
+		return fallbackName
+	}
+	return strings.ToUpper(adj[g.rnd.Intn(len(adj))]) + "-" + strings.ToUpper(noun[g.rnd.Intn(len(noun))])
+}
+
+func (g *NameGenerator) allowed(words []string) []string {
+	if len(g.blocked) == 0 {
+		return words
+	}
+	var out []string
+	for _, w := range words {
+		if _, ok := g.blocked[strings.ToLower(w)]; !ok {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func (g *NameGenerator) isTaken(network, name string) bool {
+	_, ok := g.taken[network][strings.ToUpper(name)]
+	return ok
+}
+
+func (g *NameGenerator) reserve(network, name string) {
+	if g.taken[network] == nil {
+		g.taken[network] = make(map[string]struct{})
+	}
+	g.taken[network][strings.ToUpper(name)] = struct{}{}
+}
+
+// readWordFile reads one word per line, skipping blank lines and lines starting with #.
+func readWordFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w := strings.TrimSpace(scanner.Text())
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		words = append(words, w)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no words found in %s", path)
+	}
+	return words, nil
+}
+
 // GenerateName generates a human-readable name for device identification.
+// Unlike Generate, the name is not reserved on any network.
 func GenerateName() string {
-	return strings.ToUpper(adjectives[rand.Intn(len(adjectives))]) + "-" + strings.ToUpper(nouns[rand.Intn(len(nouns))])
+	defaultNames.mu.Lock()
+	defer defaultNames.mu.Unlock()
+	return defaultNames.candidate()
 }
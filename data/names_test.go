@@ -1,6 +1,9 @@
 package data
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -11,3 +14,116 @@ func TestGenerateName(t *testing.T) {
 		t.Errorf("Expected generated name to be non-empty")
 	}
 }
+
+func TestNameGeneratorSeed(t *testing.T) {
+	a := NewNameGenerator(42)
+	b := NewNameGenerator(42)
+
+	for range 10 {
+		if na, nb := a.Generate("test-network"), b.Generate("test-network"); na != nb {
+			t.Errorf("Expected the same seed to generate the same names, got %v and %v", na, nb)
+		}
+	}
+}
+
+func TestNameGeneratorUnique(t *testing.T) {
+	g := NewNameGenerator(1)
+	if err := g.LoadWords(writeWords(t, "adjectives.txt", "brave"), writeWords(t, "nouns.txt", "otter")); err != nil {
+		t.Fatalf("Failed to load words: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for range 5 {
+		name := g.Generate("test-network")
+		if seen[name] {
+			t.Errorf("Expected unique names within a network, got %v twice", name)
+		}
+		seen[name] = true
+	}
+
+	if !seen["BRAVE-OTTER"] || !seen["BRAVE-OTTER-2"] {
+		t.Errorf("Expected suffixed names once the word lists are exhausted, got %v", seen)
+	}
+
+	if name := g.Generate("other-network"); name != "BRAVE-OTTER" {
+		t.Errorf("Expected names to be unique per network only, got %v", name)
+	}
+
+	g.Release("test-network", "BRAVE-OTTER")
+	if !g.Reserve("test-network", "brave-otter") {
+		t.Errorf("Expected released name to be available again")
+	}
+	if g.Reserve("test-network", "BRAVE-OTTER") {
+		t.Errorf("Expected reserved name to be taken")
+	}
+}
+
+func TestNameGeneratorBlocklist(t *testing.T) {
+	g := NewNameGenerator(7)
+	if err := g.LoadWords(writeWords(t, "adjectives.txt", "# comment", "rude", "", "kind"), ""); err != nil {
+		t.Fatalf("Failed to load words: %v", err)
+	}
+	if err := g.LoadBlocklist(writeWords(t, "blocklist.txt", "RUDE")); err != nil {
+		t.Fatalf("Failed to load blocklist: %v", err)
+	}
+
+	for range 20 {
+		name := g.Generate("test-network")
+		if !strings.HasPrefix(name, "KIND-") {
+			t.Errorf("Expected blocked adjective to never be used, got %v", name)
+		}
+	}
+
+	if !g.IsBlocked("Rude-Otter") {
+		t.Errorf("Expected name containing a blocked word to be reported")
+	}
+}
+
+func TestNameGeneratorSuggest(t *testing.T) {
+	g := NewNameGenerator(1)
+	if err := g.LoadWords(writeWords(t, "adjectives.txt", "brave"), writeWords(t, "nouns.txt", "otter")); err != nil {
+		t.Fatalf("Failed to load words: %v", err)
+	}
+
+	for range 3 {
+		if name := g.Suggest("test-network"); name != "BRAVE-OTTER" {
+			t.Errorf("Expected suggested names not to be reserved, got %v", name)
+		}
+	}
+	if len(g.taken) != 0 {
+		t.Errorf("Expected no names to be reserved, got %v", g.taken)
+	}
+
+	g.Reserve("test-network", "BRAVE-OTTER")
+	if name := g.Suggest("test-network"); name != "BRAVE-OTTER-2" {
+		t.Errorf("Expected reserved names not to be suggested, got %v", name)
+	}
+}
+
+func TestNameGeneratorAllBlocked(t *testing.T) {
+	g := NewNameGenerator(1)
+	g.Block(adjectives...)
+
+	if name := g.Generate("test-network"); name != fallbackName {
+		t.Errorf("Expected %v when every word is blocked, got %v", fallbackName, name)
+	}
+	if name := g.Generate("test-network"); name != fallbackName+"-2" {
+		t.Errorf("Expected fallback names to stay unique, got %v", name)
+	}
+}
+
+func TestNameGeneratorEmptyWordFile(t *testing.T) {
+	g := NewNameGenerator(1)
+	if err := g.LoadWords(writeWords(t, "adjectives.txt", "# nothing here"), ""); err == nil {
+		t.Errorf("Expected an error loading a word file without words")
+	}
+}
+
+func writeWords(t *testing.T, name string, words ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(strings.Join(words, "\n")), 0600); err != nil {
+		t.Fatalf("Failed to write word file: %v", err)
+	}
+	return path
+}
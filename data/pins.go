@@ -0,0 +1,64 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// defaultMaxPins is the number of pastes a network can pin unless MAX_PINS says otherwise.
+const defaultMaxPins = 10
+
+// ErrTooManyPins is returned when pinning a paste on a network that pinned the most it can.
+var ErrTooManyPins = errors.New("too many pinned pastes, unpin one first")
+
+// newMaxPins returns the number of pastes a network can pin from MAX_PINS.
+func newMaxPins() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_PINS")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultMaxPins
+}
+
+// PinPaste pins or unpins a paste of the network. Pinned pastes are listed first and
+// are never deleted by automatic cleanups. It returns sql.ErrNoRows if the network has
+// no such paste or it is a reply, and ErrTooManyPins if the network already pinned the
+// most it can.
+func (m *Manager) PinPaste(id int64, network string, pinned bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.pin(tx, id, network, pinned); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pin is PinPaste within a transaction.
+func (m *Manager) pin(tx *sql.Tx, id int64, network string, pinned bool) error {
+	if pinned {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pastes WHERE network = ? AND pinned = 1 AND deleted_at IS NULL AND id != ?", network, id).Scan(&count); err != nil {
+			return err
+		}
+		if count >= m.maxPins {
+			return fmt.Errorf("%w (at most %d)", ErrTooManyPins, m.maxPins)
+		}
+	}
+
+	res, err := tx.Exec("UPDATE pastes SET pinned = ? WHERE id = ? AND network = ? AND parent_id = 0 AND deleted_at IS NULL", pinned, id, network)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
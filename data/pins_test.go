@@ -0,0 +1,108 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPinPaste(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+	t.Setenv("MAX_PINS", "2")
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	wifi, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "wifi: hunter22", CreatedAt: time.Now().Add(-time.Hour)})
+	staging, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "https://staging.example.com", CreatedAt: time.Now().Add(-time.Minute)})
+	latest, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "latest", CreatedAt: time.Now()})
+
+	if err := manager.PinPaste(wifi, "other-network", true); err != sql.ErrNoRows {
+		t.Errorf("Expected paste of another network not to be pinned, got %v", err)
+	}
+	if err := manager.PinPaste(wifi, "test-network", true); err != nil {
+		t.Fatalf("Failed to pin paste: %v", err)
+	}
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 3 || pastes[0].Id != wifi || !pastes[0].Pinned || pastes[1].Id != latest {
+		t.Errorf("Expected pinned paste first and the rest newest first, got %v", pastes)
+	}
+
+	// Pinning a pinned paste again does not count against the cap
+	if err := manager.PinPaste(wifi, "test-network", true); err != nil {
+		t.Errorf("Expected pinning twice to succeed, got %v", err)
+	}
+	manager.PinPaste(staging, "test-network", true)
+	if err := manager.PinPaste(latest, "test-network", true); !errors.Is(err, ErrTooManyPins) {
+		t.Errorf("Expected pins to be capped, got %v", err)
+	}
+
+	if err := manager.PinPaste(wifi, "test-network", false); err != nil {
+		t.Fatalf("Failed to unpin paste: %v", err)
+	}
+	if err := manager.PinPaste(latest, "test-network", true); err != nil {
+		t.Errorf("Expected pin after unpinning to succeed, got %v", err)
+	}
+}
+
+func TestPinnedSecretsKept(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	pinned, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "Tr0ub4dor&3", CreatedAt: time.Now().Add(-time.Hour)})
+	manager.InsertPaste(Paste{Network: "test-network", Content: "Tr0ub4dor&4", CreatedAt: time.Now().Add(-time.Hour)})
+	manager.PinPaste(pinned, "test-network", true)
+
+	if _, err := manager.DeleteSecretsBefore(time.Now()); err != nil {
+		t.Fatalf("Failed to delete secrets: %v", err)
+	}
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 1 || pastes[0].Id != pinned {
+		t.Errorf("Expected only the pinned secret to be kept, got %v", pastes)
+	}
+}
+
+func TestImportRespectsMaxPins(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+	t.Setenv("MAX_PINS", "2")
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	export := `[{"content":"one","pinned":true},{"content":"two","pinned":true},{"content":"three","pinned":true},{"content":"reply","pinned":true,"reply_to":1}]`
+	if n, err := manager.Import([]byte(export), "test-network", FormatJSON, nil); err != nil || n != 4 {
+		t.Fatalf("Expected every paste to be imported, got %v %v", n, err)
+	}
+
+	pinned := 0
+	pastes, _ := manager.GetPastes("test-network")
+	for _, p := range pastes {
+		if p.Pinned {
+			pinned++
+		}
+		for _, r := range p.Replies {
+			if r.Pinned {
+				t.Errorf("Expected replies not to be pinned, got %v", r)
+			}
+		}
+	}
+	if pinned != 2 {
+		t.Errorf("Expected import to pin at most 2 pastes, got %v", pinned)
+	}
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode"
+)
+
+// createReactions is a SQL query that creates the table of emoji reactions to pastes.
+// Each user, which is the name of a device, reacts at most once with each emoji.
+const createReactions = `CREATE TABLE IF NOT EXISTS paste_reactions (
+	paste_id INTEGER NOT NULL,
+	user TEXT NOT NULL,
+	emoji TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (paste_id, user, emoji)
+);`
+
+// maxEmojiLength is the longest emoji accepted in bytes, enough for ZWJ sequences
+// like families and flags of subdivisions.
+const maxEmojiLength = 32
+
+// ErrInvalidEmoji is returned when reacting with something that is not an emoji.
+var ErrInvalidEmoji = errors.New("reactions must be a single emoji")
+
+// Reaction is an emoji and the users that reacted with it, in the order they did.
+type Reaction struct {
+	Emoji string
+	Users []string
+}
+
+// validEmoji reports whether s looks like a single emoji: symbols, optionally joined or
+// modified by zero width joiners, variation selectors and enclosing keycaps.
+func validEmoji(s string) bool {
+	if s == "" || len(s) > maxEmojiLength {
+		return false
+	}
+	symbols := 0
+	for _, r := range s {
+		switch {
+		case r == '\u200d' || r == '\ufe0e' || r == '\ufe0f' || r == '\u20e3':
+		case r > unicode.MaxASCII && unicode.IsSymbol(r):
+			symbols++
+		default:
+			return false
+		}
+	}
+	return symbols > 0
+}
+
+// parseReactions groups the reactions selected with pasteColumns by emoji, in the order
+// each emoji was first used.
+func parseReactions(s sql.NullString) []Reaction {
+	if !s.Valid {
+		return nil
+	}
+	var pairs [][2]string
+	if err := json.Unmarshal([]byte(s.String), &pairs); err != nil {
+		return nil
+	}
+
+	var reactions []Reaction
+	index := make(map[string]int)
+	for _, pair := range pairs {
+		emoji, user := pair[0], pair[1]
+		i, ok := index[emoji]
+		if !ok {
+			i = len(reactions)
+			index[emoji] = i
+			reactions = append(reactions, Reaction{Emoji: emoji})
+		}
+		reactions[i].Users = append(reactions[i].Users, user)
+	}
+	return reactions
+}
+
+// React adds the user's reaction with the emoji to a paste of the network, or removes
+// it if the user already reacted with it, and returns the reactions of the paste. It
+// returns sql.ErrNoRows if the network has no such paste and ErrInvalidEmoji if emoji
+// is not one.
+func (m *Manager) React(id int64, network, user, emoji string) ([]Reaction, error) {
+	if !validEmoji(emoji) {
+		return nil, ErrInvalidEmoji
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT 1 FROM pastes WHERE id = ? AND network = ? AND deleted_at IS NULL", id, network).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("DELETE FROM paste_reactions WHERE paste_id = ? AND user = ? AND emoji = ?", id, user, emoji)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		if _, err := tx.Exec("INSERT INTO paste_reactions (paste_id, user, emoji, created_at) VALUES (?, ?, ?, ?)", id, user, emoji, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	var reactions sql.NullString
+	if err := tx.QueryRow("SELECT "+reactionsColumn+" FROM pastes WHERE id = ?", id).Scan(&reactions); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return parseReactions(reactions), nil
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidEmoji(t *testing.T) {
+	tests := []struct {
+		s     string
+		valid bool
+	}{
+		{"👍", true},
+		{"👍🏽", true},
+		{"❤️", true},
+		{"👩‍💻", true},
+		{"🇳🇱", true},
+		{"", false},
+		{"ok", false},
+		{"👍 ", false},
+		{"️", false},
+		{"🎉🎉🎉🎉🎉🎉🎉🎉🎉", false},
+	}
+	for _, tt := range tests {
+		if got := validEmoji(tt.s); got != tt.valid {
+			t.Errorf("validEmoji(%q) = %v, expected %v", tt.s, got, tt.valid)
+		}
+	}
+}
+
+func TestReact(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "lunch?", CreatedAt: time.Now()})
+
+	manager.React(id, "test-network", "BRAVE-OTTER", "👍")
+	manager.React(id, "test-network", "CALM-FOX", "🎉")
+	reactions, err := manager.React(id, "test-network", "CALM-FOX", "👍")
+	if err != nil || fmt.Sprint(reactions) != "[{👍 [BRAVE-OTTER CALM-FOX]} {🎉 [CALM-FOX]}]" {
+		t.Errorf("Expected reactions grouped by emoji, got %v %v", reactions, err)
+	}
+
+	// Reacting again with the same emoji takes the reaction back
+	reactions, _ = manager.React(id, "test-network", "BRAVE-OTTER", "👍")
+	if fmt.Sprint(reactions) != "[{🎉 [CALM-FOX]} {👍 [CALM-FOX]}]" {
+		t.Errorf("Expected the reaction to be removed, got %v", reactions)
+	}
+
+	paste, _ := manager.GetPaste(id)
+	if fmt.Sprint(paste.Reactions) != fmt.Sprint(reactions) {
+		t.Errorf("Expected reactions on the paste, got %v", paste.Reactions)
+	}
+
+	if _, err := manager.React(id, "other-network", "BRAVE-OTTER", "👍"); err != sql.ErrNoRows {
+		t.Errorf("Expected reaction to a paste of another network to fail, got %v", err)
+	}
+	if _, err := manager.React(id, "test-network", "BRAVE-OTTER", "+1"); err != ErrInvalidEmoji {
+		t.Errorf("Expected invalid emoji to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"errors"
+)
+
+// ErrNotRepliable is returned when replying to a one-time paste or with one.
+var ErrNotRepliable = errors.New("one-time pastes cannot have or be replies")
+
+// InsertReply inserts p as a reply to the paste p.ParentId of the same network and
+// returns it. Replies to a reply are added to the thread of the paste it replies to,
+// so threads are one level deep. It returns sql.ErrNoRows if the network has no such
+// paste and ErrNotRepliable for one-time pastes.
+func (m *Manager) InsertReply(p Paste) (Paste, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return Paste{}, err
+	}
+	defer tx.Rollback()
+
+	parent, err := m.scanPaste(tx.QueryRow("SELECT "+pasteColumns+" FROM pastes WHERE id = ? AND network = ? AND deleted_at IS NULL", p.ParentId, p.Network))
+	if err != nil {
+		return Paste{}, err
+	}
+	if parent.OneTime || p.OneTime {
+		return Paste{}, ErrNotRepliable
+	}
+	if parent.ParentId != 0 {
+		p.ParentId = parent.ParentId
+	}
+
+	// Replies are never deduplicated, "got it" is meant to be said more than once
+	id, err := m.insertPaste(tx, p)
+	if err != nil {
+		return Paste{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Paste{}, err
+	}
+	return m.GetPaste(id)
+}
+
+// addReplies sets the Replies of the pastes of the network, oldest first.
+func (m *Manager) addReplies(network string, pastes []Paste) error {
+	index := make(map[int64]int, len(pastes))
+	for i, p := range pastes {
+		index[p.Id] = i
+	}
+
+	rows, err := m.db.Query("SELECT "+pasteColumns+" FROM pastes WHERE network = ? AND parent_id != 0 AND deleted_at IS NULL ORDER BY created_at, id", network)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := m.scanPaste(rows)
+		if err != nil {
+			return err
+		}
+		if i, ok := index[r.ParentId]; ok {
+			pastes[i].Replies = append(pastes[i].Replies, r)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestReplies(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	created := time.Now().Add(-time.Hour)
+	parent, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "https://example.com/release", CreatedAt: created})
+	manager.InsertPaste(Paste{Network: "test-network", Content: "newer paste", CreatedAt: created.Add(time.Minute)})
+	onetime, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "once", OneTime: true, CreatedAt: created})
+
+	first, err := manager.InsertReply(Paste{Network: "test-network", User: "CALM-FOX", Content: "got it", ParentId: parent, CreatedAt: created.Add(2 * time.Minute)})
+	if err != nil || first.ParentId != parent {
+		t.Fatalf("Failed to reply: %+v %v", first, err)
+	}
+	// Replies to replies join the thread and are not deduplicated
+	second, err := manager.InsertReply(Paste{Network: "test-network", User: "BOLD-LYNX", Content: "got it", ParentId: first.Id, CreatedAt: created.Add(3 * time.Minute)})
+	if err != nil || second.ParentId != parent || second.Id == first.Id {
+		t.Errorf("Expected a second reply in the thread, got %+v %v", second, err)
+	}
+
+	if _, err := manager.InsertReply(Paste{Network: "other-network", Content: "hi", ParentId: parent, CreatedAt: time.Now()}); err != sql.ErrNoRows {
+		t.Errorf("Expected reply to a paste of another network to fail, got %v", err)
+	}
+	if _, err := manager.InsertReply(Paste{Network: "test-network", Content: "hi", ParentId: onetime, CreatedAt: time.Now()}); err != ErrNotRepliable {
+		t.Errorf("Expected reply to a one-time paste to fail, got %v", err)
+	}
+	if err := manager.PinPaste(first.Id, "test-network", true); err != sql.ErrNoRows {
+		t.Errorf("Expected replies not to be pinned, got %v", err)
+	}
+
+	pastes, _ := manager.GetPastes("test-network")
+	if len(pastes) != 3 || pastes[1].Id != parent {
+		t.Fatalf("Expected replies to be left out of the list, got %v", pastes)
+	}
+	if replies := pastes[1].Replies; len(replies) != 2 || replies[0].Id != first.Id || replies[1].Id != second.Id {
+		t.Errorf("Expected replies nested oldest first, got %v", replies)
+	}
+
+	// Threads survive an export
+	var buf bytes.Buffer
+	manager.Export(&buf, "test-network", FormatMarkdown)
+	if _, err := manager.Import(buf.Bytes(), "imported", FormatMarkdown, nil); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	imported, _ := manager.GetPastes("imported")
+	if len(imported) != 2 || len(imported[1].Replies) != 2 || imported[1].Replies[1].User != "BOLD-LYNX" {
+		t.Errorf("Expected the thread to be imported, got %v", imported)
+	}
+
+	// A parent pasted again after its replies still gets them on import
+	manager.db.Exec("UPDATE pastes SET created_at = ? WHERE id = ?", created.Add(time.Hour), parent)
+	buf.Reset()
+	manager.Export(&buf, "test-network", FormatJSON)
+	if _, err := manager.Import(buf.Bytes(), "bumped", FormatJSON, nil); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	imported, _ = manager.GetPastes("bumped")
+	if len(imported) != 2 || len(imported[0].Replies) != 2 {
+		t.Errorf("Expected the thread of the bumped paste to be imported, got %v", imported)
+	}
+
+	manager.React(second.Id, "test-network", "BRAVE-OTTER", "👍")
+	manager.DeletePaste(parent)
+	var rows int
+	manager.db.QueryRow("SELECT (SELECT COUNT(*) FROM pastes WHERE parent_id = ?) + (SELECT COUNT(*) FROM paste_reactions)", parent).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("Expected replies and their reactions to be deleted with the paste, got %v rows", rows)
+	}
+}
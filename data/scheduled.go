@@ -0,0 +1,210 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// createScheduled is a SQL query that creates the table of pastes waiting to be published.
+// They are moved to the pastes table when they are due.
+const createScheduled = `CREATE TABLE IF NOT EXISTS scheduled_pastes (
+	id INTEGER NOT NULL PRIMARY KEY,
+	network TEXT NOT NULL,
+	user TEXT NOT NULL DEFAULT '',
+	device TEXT NOT NULL DEFAULT '',
+	content TEXT NOT NULL,
+	encryption TEXT NOT NULL DEFAULT '',
+	key_id INTEGER NOT NULL DEFAULT 0,
+	one_time INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	publish_at DATETIME NOT NULL
+);`
+
+// scheduledColumns are the columns read by scanScheduled, in order.
+const scheduledColumns = "id, network, user, device, content, encryption, key_id, one_time, created_at, publish_at, author"
+
+// ScheduledPaste is a paste waiting to be published at PublishAt.
+type ScheduledPaste struct {
+	Id         int64
+	Network    string
+	User       string
+	Device     string
+	Content    string
+	Encryption string
+	OneTime    bool
+	// CreatedAt is when the paste was scheduled.
+	CreatedAt time.Time
+	PublishAt time.Time
+	// Secret is the kind of secret detected in Content.
+	Secret detect.Kind
+	// Author is the device ID of the device that scheduled the paste, see Paste.Author.
+	Author string `json:"-"`
+}
+
+// scanScheduled reads a row selected with scheduledColumns and decrypts its content.
+func (m *Manager) scanScheduled(row interface{ Scan(...any) error }) (ScheduledPaste, error) {
+	var s ScheduledPaste
+	var keyID int64
+	if err := row.Scan(&s.Id, &s.Network, &s.User, &s.Device, &s.Content, &s.Encryption, &keyID, &s.OneTime, &s.CreatedAt, &s.PublishAt, &s.Author); err != nil {
+		return s, err
+	}
+
+	var err error
+	s.Content, err = m.decrypt(s.Content, keyID)
+	if s.Encryption == "" {
+		s.Secret = detect.Classify(s.Content)
+	}
+	return s, err
+}
+
+// SchedulePaste stores p to be published at the given time and returns it. p.CreatedAt is
+// recorded as the time it was scheduled.
+func (m *Manager) SchedulePaste(p Paste, at time.Time) (ScheduledPaste, error) {
+	content, keyID, err := m.cipher.encrypt(p.Content)
+	if err != nil {
+		return ScheduledPaste{}, err
+	}
+
+	res, err := m.db.Exec("INSERT INTO scheduled_pastes (network, user, device, content, encryption, key_id, one_time, created_at, publish_at, author) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.Network, p.User, p.Device, content, p.Encryption, keyID, p.OneTime, p.CreatedAt, at, p.Author)
+	if err != nil {
+		return ScheduledPaste{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return ScheduledPaste{}, err
+	}
+	return m.scanScheduled(m.db.QueryRow("SELECT "+scheduledColumns+" FROM scheduled_pastes WHERE id = ?", id))
+}
+
+// ScheduledPastes returns the pastes of the network waiting to be published, the next due first.
+func (m *Manager) ScheduledPastes(network string) ([]ScheduledPaste, error) {
+	rows, err := m.db.Query("SELECT "+scheduledColumns+" FROM scheduled_pastes WHERE network = ? ORDER BY julianday(publish_at), id", network)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scheduled []ScheduledPaste
+	for rows.Next() {
+		s, err := m.scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, s)
+	}
+	return scheduled, rows.Err()
+}
+
+// NextScheduled returns when the next scheduled paste is due, and false if there is none.
+func (m *Manager) NextScheduled() (time.Time, bool, error) {
+	var at time.Time
+	err := m.db.QueryRow("SELECT publish_at FROM scheduled_pastes ORDER BY julianday(publish_at) LIMIT 1").Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	return at, err == nil, err
+}
+
+// CancelScheduled deletes a paste of the network waiting to be published. It returns
+// sql.ErrNoRows if the network has no such paste, including when it was already published.
+func (m *Manager) CancelScheduled(id int64, network string) error {
+	res, err := m.db.Exec("DELETE FROM scheduled_pastes WHERE id = ? AND network = ?", id, network)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PublishScheduled publishes the scheduled pastes due at the given time, dated when they
+// were due, and returns the networks they were published to. Scheduled pastes are always
+// inserted as new pastes, identical recent pastes are not bumped instead.
+func (m *Manager) PublishScheduled(now time.Time) ([]string, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("DELETE FROM scheduled_pastes WHERE julianday(publish_at) <= julianday(?) RETURNING "+scheduledColumns, now)
+	if err != nil {
+		return nil, err
+	}
+	var due []ScheduledPaste
+	for rows.Next() {
+		s, err := m.scanScheduled(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var networks []string
+	for _, s := range due {
+		p := Paste{Network: s.Network, User: s.User, Device: s.Device, Content: s.Content, Encryption: s.Encryption, OneTime: s.OneTime, CreatedAt: s.PublishAt, Author: s.Author}
+		if _, err := m.insertPaste(tx, p); err != nil {
+			return nil, err
+		}
+		if !seen[s.Network] {
+			seen[s.Network] = true
+			networks = append(networks, s.Network)
+		}
+	}
+	return networks, tx.Commit()
+}
+
+// reencryptScheduled decrypts every scheduled paste with the current key and encrypts it with next.
+func (m *Manager) reencryptScheduled(tx *sql.Tx, next *rowCipher) error {
+	rows, err := tx.Query("SELECT id, content, key_id FROM scheduled_pastes")
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		id      int64
+		content string
+	}
+	var all []row
+	for rows.Next() {
+		var r row
+		var keyID int64
+		if err := rows.Scan(&r.id, &r.content, &keyID); err != nil {
+			rows.Close()
+			return err
+		}
+		if r.content, err = m.decrypt(r.content, keyID); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range all {
+		content, keyID, err := next.encrypt(r.content)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE scheduled_pastes SET content = ?, key_id = ? WHERE id = ?", content, keyID, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
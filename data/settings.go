@@ -0,0 +1,47 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// createSettings is a SQL query that creates the table of per network settings.
+// Networks without a row use the defaults.
+const createSettings = `CREATE TABLE IF NOT EXISTS network_settings (
+	network TEXT NOT NULL PRIMARY KEY,
+	dedup INTEGER NOT NULL DEFAULT 1,
+	dedup_window INTEGER NOT NULL DEFAULT 0
+);`
+
+// Settings are the settings of a network.
+type Settings struct {
+	// Dedup bumps an identical paste instead of inserting a duplicate.
+	Dedup bool
+	// DedupWindow is how recent an identical paste must be to be bumped.
+	// Zero uses the server default from DEDUP_WINDOW.
+	DedupWindow time.Duration
+}
+
+// DefaultSettings are the settings of networks that never changed them.
+var DefaultSettings = Settings{Dedup: true}
+
+// GetSettings returns the settings of the network.
+func (m *Manager) GetSettings(network string) (Settings, error) {
+	s := DefaultSettings
+	var window int64
+	err := m.db.QueryRow("SELECT dedup, dedup_window FROM network_settings WHERE network = ?", network).Scan(&s.Dedup, &window)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultSettings, nil
+	}
+	s.DedupWindow = time.Duration(window) * time.Second
+	return s, err
+}
+
+// SaveSettings replaces the settings of the network.
+func (m *Manager) SaveSettings(network string, s Settings) error {
+	_, err := m.db.Exec(`INSERT INTO network_settings (network, dedup, dedup_window) VALUES (?, ?, ?)
+		ON CONFLICT(network) DO UPDATE SET dedup = excluded.dedup, dedup_window = excluded.dedup_window`,
+		network, s.Dedup, int64(s.DedupWindow/time.Second))
+	return err
+}
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// createTags is a SQL query that creates the table of paste tags. Tags found as hashtags
+// in the content follow its edits, manual tags are set by users.
+const createTags = `CREATE TABLE IF NOT EXISTS paste_tags (
+	paste_id INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	manual INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (paste_id, tag)
+);`
+
+// maxTags is the number of manual tags a paste can have.
+const maxTags = 20
+
+var (
+	// ErrInvalidTag is returned for tags that do not match tagPattern.
+	ErrInvalidTag = errors.New("tags are made of letters, digits, _ and -, start with a letter or digit and are at most 32 characters long")
+	// ErrTooManyTags is returned when tagging a paste with more than maxTags tags.
+	ErrTooManyTags = fmt.Errorf("a paste can have at most %d tags", maxTags)
+)
+
+var (
+	tagPattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}_-]{0,31}$`)
+
+	// hashtagPattern finds hashtags in content. The # must not follow a word, / or &
+	// so that URL fragments, HTML entities and issue references in paths are skipped.
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}][\p{L}\p{N}_-]*)`)
+)
+
+// TagCount is the number of pastes of a network with a tag.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// execer is a database connection or transaction.
+type execer interface {
+	Exec(string, ...any) (sql.Result, error)
+}
+
+// NormalizeTag returns a tag in the form it is stored in, lower case and without a
+// leading #. It returns ErrInvalidTag if it is not a valid tag.
+func NormalizeTag(s string) (string, error) {
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+	if !tagPattern.MatchString(tag) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTag, s)
+	}
+	return tag, nil
+}
+
+// hashtags returns the tags found as hashtags in the content, sorted and without
+// duplicates. Hashtags without a letter, like #42, are not tags.
+func hashtags(content string) []string {
+	var tags []string
+	for _, m := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		tag, err := NormalizeTag(strings.TrimRight(m[1], "_-"))
+		if err != nil || !strings.ContainsFunc(tag, unicode.IsLetter) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// parseTags splits the tags selected with pasteColumns.
+func parseTags(s sql.NullString) []string {
+	return strings.Fields(s.String)
+}
+
+// tagContent replaces the tags of a paste that come from hashtags in its content. The
+// content of end-to-end encrypted pastes, secrets, one-time pastes and attachments is
+// not tagged, as tags are shown to every device and stored unencrypted. Nothing is
+// tagged when contents are encrypted at rest, which tags would leak. Replies are not
+// tagged either, they belong to the thread of a tagged paste.
+func (m *Manager) tagContent(db execer, id int64, p Paste) error {
+	if _, err := db.Exec("DELETE FROM paste_tags WHERE paste_id = ? AND manual = 0", id); err != nil {
+		return err
+	}
+	if m.cipher != nil || p.Encrypted() || p.Secret != detect.None || p.OneTime || p.Attachment != nil || p.ParentId != 0 {
+		return nil
+	}
+	return addTags(db, id, hashtags(p.Content), false)
+}
+
+// addTags adds tags to a paste. Tags the paste already has are left as they are.
+func addTags(db execer, id int64, tags []string, manual bool) error {
+	for _, tag := range tags {
+		if _, err := db.Exec("INSERT OR IGNORE INTO paste_tags (paste_id, tag, manual) VALUES (?, ?, ?)", id, tag, manual); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTags replaces the manual tags of a paste of the network. Hashtags in the content
+// stay tags whether they are given or not. It returns sql.ErrNoRows if the network has
+// no such paste, ErrInvalidTag for invalid tags and ErrTooManyTags if too many are given.
+func (m *Manager) SetTags(id int64, network string, tags []string) error {
+	var manual []string
+	for _, t := range tags {
+		tag, err := NormalizeTag(t)
+		if err != nil {
+			return err
+		}
+		manual = append(manual, tag)
+	}
+	slices.Sort(manual)
+	manual = slices.Compact(manual)
+	if len(manual) > maxTags {
+		return ErrTooManyTags
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	p, err := m.scanPaste(tx.QueryRow("SELECT "+pasteColumns+" FROM pastes WHERE id = ? AND network = ? AND deleted_at IS NULL", id, network))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM paste_tags WHERE paste_id = ?", id); err != nil {
+		return err
+	}
+	if err := m.tagContent(tx, id, p); err != nil {
+		return err
+	}
+	if err := addTags(tx, id, manual, true); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TagCounts returns the tags of the network's pastes with the number of pastes having
+// each, most used first.
+func (m *Manager) TagCounts(network string) ([]TagCount, error) {
+	rows, err := m.db.Query(`SELECT tag, COUNT(*) FROM paste_tags JOIN pastes ON pastes.id = paste_tags.paste_id
+		WHERE pastes.network = ? AND pastes.parent_id = 0 AND pastes.deleted_at IS NULL GROUP BY tag ORDER BY COUNT(*) DESC, tag`, network)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TagCount
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Tag, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
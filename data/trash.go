@@ -0,0 +1,60 @@
+package data
+
+import (
+	"time"
+)
+
+// TrashPaste moves a paste of the network to the trash, recording who deleted it and
+// when. Trashed pastes are hidden everywhere until restored with RestorePaste or purged
+// with PurgeTrash. It returns sql.ErrNoRows if the network has no such paste or it is
+// already in the trash.
+func (m *Manager) TrashPaste(id int64, network, by string, at time.Time) (Paste, error) {
+	return m.scanPaste(m.db.QueryRow("UPDATE pastes SET deleted_at = ?, deleted_by = ? WHERE id = ? AND network = ? AND deleted_at IS NULL RETURNING "+pasteColumns, at, by, id, network))
+}
+
+// RestorePaste takes a paste of the network trashed after since out of the trash. It
+// returns sql.ErrNoRows if the network has no such paste in the trash.
+func (m *Manager) RestorePaste(id int64, network string, since time.Time) (Paste, error) {
+	return m.scanPaste(m.db.QueryRow(`UPDATE pastes SET deleted_at = NULL, deleted_by = ''
+		WHERE id = ? AND network = ? AND deleted_at IS NOT NULL AND julianday(deleted_at) >= julianday(?) RETURNING `+pasteColumns, id, network, since))
+}
+
+// LastTrashed returns the ID of the paste of the network most recently trashed by the
+// user after since. It returns sql.ErrNoRows if there is none.
+func (m *Manager) LastTrashed(network, by string, since time.Time) (int64, error) {
+	var id int64
+	err := m.db.QueryRow(`SELECT id FROM pastes WHERE network = ? AND deleted_by = ? AND deleted_at IS NOT NULL AND julianday(deleted_at) >= julianday(?)
+		ORDER BY deleted_at DESC LIMIT 1`, network, by, since).Scan(&id)
+	return id, err
+}
+
+// TrashedPastes returns the pastes of the network trashed after since, most recently
+// trashed first.
+func (m *Manager) TrashedPastes(network string, since time.Time) ([]Paste, error) {
+	rows, err := m.db.Query(`SELECT `+pasteColumns+` FROM pastes WHERE network = ? AND deleted_at IS NOT NULL AND julianday(deleted_at) >= julianday(?)
+		ORDER BY deleted_at DESC`, network, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pastes []Paste
+	for rows.Next() {
+		p, err := m.scanPaste(rows)
+		if err != nil {
+			return nil, err
+		}
+		pastes = append(pastes, p)
+	}
+	return pastes, rows.Err()
+}
+
+// PurgeTrash deletes the pastes trashed before the given time for good, pinned or not,
+// and returns how many were deleted.
+func (m *Manager) PurgeTrash(before time.Time) (int64, error) {
+	res, err := m.db.Exec("DELETE FROM pastes WHERE deleted_at IS NOT NULL AND julianday(deleted_at) < julianday(?)", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestTrashPaste(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "keep me", CreatedAt: time.Now()})
+	manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "other", CreatedAt: time.Now()})
+
+	deletedAt := time.Now()
+	paste, err := manager.TrashPaste(id, "test-network", "CALM-FOX", deletedAt)
+	if err != nil || paste.DeletedBy != "CALM-FOX" || paste.DeletedAt == nil {
+		t.Fatalf("Expected paste to be trashed by CALM-FOX, got %+v %v", paste, err)
+	}
+	if _, err := manager.TrashPaste(id, "other-network", "CALM-FOX", deletedAt); err != sql.ErrNoRows {
+		t.Errorf("Expected paste of another network not to be trashed, got %v", err)
+	}
+	if _, err := manager.TrashPaste(id, "test-network", "CALM-FOX", deletedAt); err != sql.ErrNoRows {
+		t.Errorf("Expected trashed paste not to be trashed again, got %v", err)
+	}
+
+	// Trashed pastes are hidden
+	if pastes, _ := manager.GetPastes("test-network"); len(pastes) != 1 {
+		t.Errorf("Expected trashed paste to be hidden, got %v", pastes)
+	}
+	if _, err := manager.GetPaste(id); err != sql.ErrNoRows {
+		t.Errorf("Expected trashed paste not to be found, got %v", err)
+	}
+	if trash, _ := manager.TrashedPastes("test-network", deletedAt.Add(-time.Minute)); len(trash) != 1 || trash[0].Id != id {
+		t.Errorf("Expected paste in the trash, got %v", trash)
+	}
+
+	// Only recently trashed pastes of the network can be restored
+	if _, err := manager.RestorePaste(id, "other-network", deletedAt.Add(-time.Minute)); err != sql.ErrNoRows {
+		t.Errorf("Expected paste of another network not to be restored, got %v", err)
+	}
+	if _, err := manager.RestorePaste(id, "test-network", deletedAt.Add(time.Minute)); err != sql.ErrNoRows {
+		t.Errorf("Expected paste trashed before the window not to be restored, got %v", err)
+	}
+	if last, err := manager.LastTrashed("test-network", "CALM-FOX", deletedAt.Add(-time.Minute)); err != nil || last != id {
+		t.Errorf("Expected last trashed paste %v, got %v %v", id, last, err)
+	}
+	paste, err = manager.RestorePaste(id, "test-network", deletedAt.Add(-time.Minute))
+	if err != nil || paste.DeletedAt != nil || paste.DeletedBy != "" {
+		t.Errorf("Expected paste to be restored, got %+v %v", paste, err)
+	}
+	if pastes, _ := manager.GetPastes("test-network"); len(pastes) != 2 {
+		t.Errorf("Expected restored paste to be listed, got %v", pastes)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	old, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "old", CreatedAt: time.Now()})
+	recent, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "recent", CreatedAt: time.Now()})
+	manager.InsertPaste(Paste{Network: "test-network", Content: "live", CreatedAt: time.Now()})
+	manager.PinPaste(old, "test-network", true)
+	manager.TrashPaste(old, "test-network", "BRAVE-OTTER", time.Now().Add(-time.Hour))
+	manager.TrashPaste(recent, "test-network", "BRAVE-OTTER", time.Now())
+
+	n, err := manager.PurgeTrash(time.Now().Add(-time.Minute))
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 paste to be purged, got %v %v", n, err)
+	}
+	var count int
+	manager.db.QueryRow("SELECT COUNT(*) FROM pastes").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected the recently trashed and the live paste to be kept, got %v pastes", count)
+	}
+}
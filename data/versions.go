@@ -0,0 +1,185 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// createVersions is a SQL query that creates the table of earlier versions of edited
+// pastes. The current version is always the one in the pastes table.
+const createVersions = `CREATE TABLE IF NOT EXISTS paste_versions (
+	id INTEGER NOT NULL PRIMARY KEY,
+	paste_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	encryption TEXT NOT NULL DEFAULT '',
+	key_id INTEGER NOT NULL DEFAULT 0,
+	user TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);`
+
+// ErrNotEditable is returned when editing a one-time paste or an attachment.
+var ErrNotEditable = errors.New("one-time pastes and files cannot be edited")
+
+// Version is a version of a paste's content.
+type Version struct {
+	Number     int
+	Content    string
+	Encryption string
+	// User wrote this version, CreatedAt is when.
+	User      string
+	CreatedAt time.Time
+	// Secret is the kind of secret detected in Content.
+	Secret detect.Kind
+}
+
+// EditPaste replaces the content of a paste of the network with the content of edit and
+// keeps the previous content as a version. edit.User is recorded as the editor and
+// edit.CreatedAt as the time of the edit. It returns sql.ErrNoRows if the network has no
+// such paste.
+func (m *Manager) EditPaste(id int64, edit Paste) (Paste, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return Paste{}, err
+	}
+	defer tx.Rollback()
+
+	current, err := m.scanPaste(tx.QueryRow("SELECT "+pasteColumns+" FROM pastes WHERE id = ? AND network = ? AND deleted_at IS NULL", id, edit.Network))
+	if err != nil {
+		return Paste{}, err
+	}
+	if current.OneTime || current.Attachment != nil {
+		return Paste{}, ErrNotEditable
+	}
+	if current.Content == edit.Content && current.Encryption == edit.Encryption {
+		return current, nil
+	}
+
+	previous := current.currentVersion()
+	content, keyID, err := m.cipher.encrypt(previous.Content)
+	if err != nil {
+		return Paste{}, err
+	}
+	if _, err := tx.Exec("INSERT INTO paste_versions (paste_id, version, content, encryption, key_id, user, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id, previous.Number, content, previous.Encryption, keyID, previous.User, previous.CreatedAt); err != nil {
+		return Paste{}, err
+	}
+
+	// The paste stays masked while its versions hold a secret, and replies stay untagged
+	next := Paste{Content: edit.Content, Encryption: edit.Encryption, ParentId: current.ParentId, OneTime: current.OneTime, Secret: current.Secret}
+	classify(&next)
+	content, keyID, err = m.cipher.encrypt(next.Content)
+	if err != nil {
+		return Paste{}, err
+	}
+	if _, err := tx.Exec(`UPDATE pastes SET content = ?, encryption = ?, key_id = ?, secret = ?, type = ?, language = ?, content_hash = ?,
+		version = version + 1, edited_at = ?, edited_by = ? WHERE id = ?`,
+		content, next.Encryption, keyID, next.Secret, next.Type, next.Language, m.cipher.hash(next.Content), edit.CreatedAt, edit.User, id); err != nil {
+		return Paste{}, err
+	}
+	if err := m.tagContent(tx, id, next); err != nil {
+		return Paste{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Paste{}, err
+	}
+	return m.GetPaste(id)
+}
+
+// Versions returns every version of a paste of the network, oldest first and ending with
+// the current one. It returns sql.ErrNoRows if the network has no such paste.
+func (m *Manager) Versions(id int64, network string) ([]Version, error) {
+	current, err := m.GetPaste(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Network != network {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := m.db.Query("SELECT version, content, encryption, key_id, user, created_at FROM paste_versions WHERE paste_id = ? ORDER BY version", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		var keyID int64
+		if err := rows.Scan(&v.Number, &v.Content, &v.Encryption, &keyID, &v.User, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		if v.Content, err = m.decrypt(v.Content, keyID); err != nil {
+			return nil, err
+		}
+		if v.Encryption == "" {
+			v.Secret = detect.Classify(v.Content)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return append(versions, current.currentVersion()), nil
+}
+
+// currentVersion describes the current content of the paste as a version. Like older
+// versions, it is classified on its own: the paste keeps the secret found in any of them.
+func (p Paste) currentVersion() Version {
+	v := Version{Number: p.Version, Content: p.Content, Encryption: p.Encryption, User: p.User, CreatedAt: p.CreatedAt}
+	if v.Encryption == "" {
+		v.Secret = detect.Classify(v.Content)
+	}
+	if p.EditedAt != nil {
+		v.User, v.CreatedAt = p.EditedBy, *p.EditedAt
+	}
+	return v
+}
+
+// reencryptVersions decrypts every paste version with the current key and encrypts it with next.
+func (m *Manager) reencryptVersions(tx *sql.Tx, next *rowCipher) error {
+	rows, err := tx.Query("SELECT id, content, key_id FROM paste_versions")
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		id      int64
+		content string
+	}
+	var all []row
+	for rows.Next() {
+		var r row
+		var keyID int64
+		if err := rows.Scan(&r.id, &r.content, &keyID); err != nil {
+			rows.Close()
+			return err
+		}
+		if r.content, err = m.decrypt(r.content, keyID); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range all {
+		content, keyID, err := next.encrypt(r.content)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE paste_versions SET content = ?, key_id = ? WHERE id = ?", content, keyID, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
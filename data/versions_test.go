@@ -0,0 +1,153 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/kuiadev/pastytext/detect"
+)
+
+func TestEditPaste(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	created := time.Now().Add(-time.Hour)
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "https://staging.example.com", CreatedAt: created})
+
+	if _, err := manager.EditPaste(id, Paste{Network: "other-network", Content: "hijacked", CreatedAt: time.Now()}); err != sql.ErrNoRows {
+		t.Errorf("Expected paste of another network not to be edited, got %v", err)
+	}
+
+	paste, err := manager.EditPaste(id, Paste{Network: "test-network", User: "CALM-FOX", Content: "Tr0ub4dor&3", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to edit paste: %v", err)
+	}
+	if paste.Content != "Tr0ub4dor&3" || paste.Version != 2 || paste.EditedBy != "CALM-FOX" || paste.EditedAt == nil {
+		t.Errorf("Expected edited paste, got %+v", paste)
+	}
+	if paste.Secret != detect.Password || paste.Type != detect.TypeSecret || !paste.CreatedAt.Equal(created) {
+		t.Errorf("Expected edit to be classified again, got %+v", paste)
+	}
+
+	// Editing to the same content does not create a version
+	manager.EditPaste(id, Paste{Network: "test-network", User: "CALM-FOX", Content: "Tr0ub4dor&3", CreatedAt: time.Now()})
+	manager.EditPaste(id, Paste{Network: "test-network", User: "BRAVE-OTTER", Content: "https://staging.example.org", CreatedAt: time.Now()})
+
+	// The password is still in the history, so the paste stays a secret
+	if paste, _ := manager.GetPaste(id); paste.Secret != detect.Password {
+		t.Errorf("Expected the paste to stay a secret, got %+v", paste)
+	}
+
+	versions, err := manager.Versions(id, "test-network")
+	if err != nil || len(versions) != 3 {
+		t.Fatalf("Expected 3 versions, got %v %v", versions, err)
+	}
+	want := []struct {
+		content string
+		user    string
+		secret  detect.Kind
+	}{
+		{"https://staging.example.com", "BRAVE-OTTER", detect.None},
+		{"Tr0ub4dor&3", "CALM-FOX", detect.Password},
+		{"https://staging.example.org", "BRAVE-OTTER", detect.None},
+	}
+	for i, w := range want {
+		v := versions[i]
+		if v.Number != i+1 || v.Content != w.content || v.User != w.user || v.Secret != w.secret {
+			t.Errorf("Expected version %v to be %v by %v, got %+v", i+1, w.content, w.user, v)
+		}
+	}
+	if !versions[0].CreatedAt.Equal(created) {
+		t.Errorf("Expected first version to keep the paste time, got %v", versions[0].CreatedAt)
+	}
+
+	if _, err := manager.Versions(id, "other-network"); err != sql.ErrNoRows {
+		t.Errorf("Expected versions of another network to be hidden, got %v", err)
+	}
+
+	// Versions go away with their paste
+	manager.DeletePaste(id)
+	var count int
+	manager.db.QueryRow("SELECT COUNT(*) FROM paste_versions").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected versions to be deleted with the paste, got %v", count)
+	}
+}
+
+func TestEditReply(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	parent, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "release notes", CreatedAt: time.Now()})
+	reply, _ := manager.InsertReply(Paste{Network: "test-network", Content: "looks good", ParentId: parent, CreatedAt: time.Now()})
+
+	edited, err := manager.EditPaste(reply.Id, Paste{Network: "test-network", Content: "looks good #release", CreatedAt: time.Now()})
+	if err != nil || edited.ParentId != parent {
+		t.Fatalf("Expected the reply to be edited, got %+v %v", edited, err)
+	}
+	if counts, _ := manager.TagCounts("test-network"); len(counts) != 0 {
+		t.Errorf("Expected edited replies not to be tagged, got %v", counts)
+	}
+}
+
+func TestEditPasteNotEditable(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "wifi password", OneTime: true, CreatedAt: time.Now()})
+	if _, err := manager.EditPaste(id, Paste{Network: "test-network", Content: "changed", CreatedAt: time.Now()}); err != ErrNotEditable {
+		t.Errorf("Expected one-time paste not to be editable, got %v", err)
+	}
+}
+
+func TestEditPasteEncrypted(t *testing.T) {
+	setupTest()
+	defer teardownTest()
+
+	key, _ := GenerateKey()
+	t.Setenv("DB_KEY", key)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create new Manager: %v", err)
+	}
+	defer manager.Close()
+
+	id, _ := manager.InsertPaste(Paste{Network: "test-network", Content: "first", CreatedAt: time.Now()})
+	manager.EditPaste(id, Paste{Network: "test-network", Content: "second", CreatedAt: time.Now()})
+
+	var stored string
+	manager.db.QueryRow("SELECT content FROM paste_versions WHERE paste_id = ?", id).Scan(&stored)
+	if stored == "first" {
+		t.Errorf("Expected versions to be encrypted at rest")
+	}
+
+	newKey, _ := GenerateKey()
+	master, _ := ParseKey(newKey)
+	if err := manager.RotateKey(master); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	versions, err := manager.Versions(id, "test-network")
+	if err != nil || len(versions) != 2 || versions[0].Content != "first" {
+		t.Errorf("Expected versions to survive key rotation, got %v %v", versions, err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package detect classifies paste contents that look like secrets, so the server
+// can avoid broadcasting them in full.
+package detect
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Kind is the kind of secret found in a paste. The zero value means no secret was found.
+type Kind string
+
+const (
+	None        Kind = ""
+	PrivateKey  Kind = "private-key"
+	AWSKey      Kind = "aws-key"
+	GitHubToken Kind = "github-token"
+	JWT         Kind = "jwt"
+	CreditCard  Kind = "credit-card"
+	Password    Kind = "password"
+)
+
+var (
+	privateKeyRe  = regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)
+	awsKeyRe      = regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA)[A-Z0-9]{16}\b`)
+	awsSecretRe   = regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[:=]\s*["']?[A-Za-z0-9/+]{40}\b`)
+	githubTokenRe = regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`)
+	jwtRe         = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+	cardRe        = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+// passwordSymbols are the characters that count as special in the password heuristic.
+// Punctuation that also ends sentences or appears in links, such as dots, commas,
+// question marks and colons, is not enough.
+const passwordSymbols = `!@#$%^&*{}|<>~`
+
+// maxPasswordLength is the longest single word taken for a password.
+const maxPasswordLength = 64
+
+// Classify returns the kind of secret found in the text, checking the most specific
+// kinds first.
+func Classify(text string) Kind {
+	switch {
+	case privateKeyRe.MatchString(text):
+		return PrivateKey
+	case awsKeyRe.MatchString(text) || awsSecretRe.MatchString(text):
+		return AWSKey
+	case githubTokenRe.MatchString(text):
+		return GitHubToken
+	case hasJWT(text):
+		return JWT
+	case hasCardNumber(text):
+		return CreditCard
+	case isPassword(text):
+		return Password
+	}
+	return None
+}
+
+// hasJWT reports whether the text contains a token whose header decodes to a JWT header.
+func hasJWT(text string) bool {
+	for _, token := range jwtRe.FindAllString(text, -1) {
+		header, err := base64.RawURLEncoding.DecodeString(strings.SplitN(token, ".", 2)[0])
+		if err != nil {
+			continue
+		}
+		var h struct {
+			Alg string `json:"alg"`
+		}
+		if json.Unmarshal(header, &h) == nil && h.Alg != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCardNumber reports whether the text contains a 13 to 19 digit number, optionally
+// grouped with spaces or dashes, that passes the Luhn check.
+func hasCardNumber(text string) bool {
+	for _, match := range cardRe.FindAllString(text, -1) {
+		digits := strings.Map(func(r rune) rune {
+			if r == ' ' || r == '-' {
+				return -1
+			}
+			return r
+		}, match)
+		if luhn(digits) {
+			return true
+		}
+	}
+	return false
+}
+
+// luhn reports whether the digits pass the Luhn checksum.
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isPassword reports whether the whole text is a single word that looks like a strong
+// password: 8 to 64 characters with lower and upper case letters, a digit and a symbol.
+// Words that TypeOf recognises, such as links, email addresses and phone numbers, and
+// paths are never passwords, however mixed their characters are.
+func isPassword(text string) bool {
+	if len(text) < 8 || len(text) > maxPasswordLength || strings.IndexFunc(text, unicode.IsSpace) >= 0 || strings.Contains(text, "/") {
+		return false
+	}
+	if t, _ := TypeOf(text); t != TypeText {
+		return false
+	}
+	return strings.IndexFunc(text, unicode.IsLower) >= 0 &&
+		strings.IndexFunc(text, unicode.IsUpper) >= 0 &&
+		strings.IndexFunc(text, unicode.IsDigit) >= 0 &&
+		strings.ContainsAny(text, passwordSymbols)
+}
@@ -0,0 +1,119 @@
+package detect
+
+import (
+	"encoding/json"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// ContentType is the kind of content of a paste.
+type ContentType string
+
+const (
+	TypeText      ContentType = "text"
+	TypeMultiline ContentType = "multiline"
+	TypeURL       ContentType = "url"
+	TypeEmail     ContentType = "email"
+	TypePhone     ContentType = "phone"
+	TypeJSON      ContentType = "json"
+	TypeCode      ContentType = "code"
+	TypeFile      ContentType = "file"
+	TypeImage     ContentType = "image"
+	// TypeSecret is used for pastes in which Classify found a secret.
+	TypeSecret ContentType = "secret"
+)
+
+// Types lists every content type.
+var Types = []ContentType{TypeText, TypeMultiline, TypeURL, TypeEmail, TypePhone, TypeJSON, TypeCode, TypeFile, TypeImage, TypeSecret}
+
+var (
+	urlRe            = regexp.MustCompile(`(?i)^(https?|ftp)://[^\s/$.?#].[^\s]*$`)
+	bareURLRe        = regexp.MustCompile(`^[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+([/?].*)?$`)
+	phoneRe          = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+	codeLineEndingRe = regexp.MustCompile(`(?m)[;{}]\s*$`)
+)
+
+// languages are checked in order, the first matching pattern names the language.
+var languages = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"php", regexp.MustCompile(`<\?php`)},
+	{"shell", regexp.MustCompile(`(?m)^#!/(usr/)?bin/(env )?(ba|z)?sh|^\s*(sudo|apt(-get)?|brew|export|echo|cd|ls|grep|curl) `)},
+	{"go", regexp.MustCompile(`(?m)^package \w+$|^func (\(\w+ \*?\w+\) )?\w+\(|:= `)},
+	{"rust", regexp.MustCompile(`(?m)^\s*(pub )?fn \w+\(|let mut |println!\(`)},
+	{"python", regexp.MustCompile(`(?m)^\s*def \w+\(.*\):|^\s*(from \w+ )?import \w+$|^if __name__ == |print\(`)},
+	{"java", regexp.MustCompile(`public (static )?(class|void)|System\.out\.print`)},
+	{"c", regexp.MustCompile(`(?m)^#include [<"]`)},
+	{"javascript", regexp.MustCompile(`(?m)\bfunction\s*\w*\(|^\s*(const|let|var) \w+ = |=> |console\.log\(`)},
+	{"sql", regexp.MustCompile(`(?i)\b(SELECT .+ FROM|INSERT INTO|CREATE TABLE|UPDATE \w+ SET|DELETE FROM)\b`)},
+	{"html", regexp.MustCompile(`(?i)<(!doctype html|html|head|body|div|span|p|a|script)[\s>]`)},
+	{"css", regexp.MustCompile(`(?m)^[\w.#:\- ,>]+\{\s*$|^\s*[\w-]+:\s*[^;]+;\s*$`)},
+}
+
+// TypeOf returns the content type of the text and, for code, a guess of its language
+// which is empty if no language was recognised. It does not look for secrets, use
+// Classify for that.
+func TypeOf(text string) (ContentType, string) {
+	trimmed := strings.TrimSpace(text)
+	single := !strings.ContainsAny(trimmed, " \t\n")
+
+	switch {
+	case (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)):
+		return TypeJSON, ""
+	case single && (urlRe.MatchString(trimmed) || (bareURLRe.MatchString(trimmed) && !isNumber(trimmed))):
+		return TypeURL, ""
+	case single && isEmail(trimmed):
+		return TypeEmail, ""
+	case isPhone(trimmed):
+		return TypePhone, ""
+	}
+
+	if lang := language(trimmed); lang != "" {
+		return TypeCode, lang
+	}
+	if lines := strings.Count(trimmed, "\n") + 1; lines > 1 {
+		if len(codeLineEndingRe.FindAllString(trimmed, -1))*2 >= lines {
+			return TypeCode, ""
+		}
+		return TypeMultiline, ""
+	}
+	return TypeText, ""
+}
+
+// language guesses the programming language of the text.
+func language(text string) string {
+	for _, l := range languages {
+		if l.pattern.MatchString(text) {
+			return l.name
+		}
+	}
+	return ""
+}
+
+func isEmail(text string) bool {
+	addr, err := mail.ParseAddress(text)
+	return err == nil && addr.Address == text && strings.Contains(text[strings.LastIndex(text, "@"):], ".")
+}
+
+// isPhone reports whether the text is a phone number of 7 to 15 digits, optionally
+// formatted with a leading plus, spaces, dashes, dots and parentheses.
+func isPhone(text string) bool {
+	if !phoneRe.MatchString(text) {
+		return false
+	}
+	digits := 0
+	for _, r := range text {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// isNumber reports whether the text is made of digits and dots only, like a version or
+// a decimal number, which would otherwise pass for a bare host name.
+func isNumber(text string) bool {
+	return strings.Trim(text, "0123456789.") == ""
+}
@@ -0,0 +1,43 @@
+package detect
+
+import "testing"
+
+func TestTypeOf(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantType ContentType
+		wantLang string
+	}{
+		{"hello world", TypeText, ""},
+		{"first line\nsecond line", TypeMultiline, ""},
+		{"https://example.com/page?id=1", TypeURL, ""},
+		{"www.example.com", TypeURL, ""},
+		{"1.2.3", TypeText, ""},
+		{"see https://example.com", TypeText, ""},
+		{"jane@example.com", TypeEmail, ""},
+		{"jane@localhost", TypeText, ""},
+		{"+1 (555) 123-4567", TypePhone, ""},
+		{"555-1234", TypePhone, ""},
+		{"12", TypeText, ""},
+		{`{"name": "pastytext", "tags": [1, 2]}`, TypeJSON, ""},
+		{`[1, 2, 3]`, TypeJSON, ""},
+		{`{"broken": }`, TypeText, ""},
+		{"package main\n\nfunc main() {\n\tx := 1\n}", TypeCode, "go"},
+		{"def hello(name):\n    print(name)", TypeCode, "python"},
+		{"const x = 1;\nconsole.log(x);", TypeCode, "javascript"},
+		{"#!/bin/bash\necho hi", TypeCode, "shell"},
+		{"SELECT id FROM pastes WHERE network = ?", TypeCode, "sql"},
+		{"#include <stdio.h>\nint main() { return 0; }", TypeCode, "c"},
+		{"fn main() {\n    let mut x = 1;\n}", TypeCode, "rust"},
+		{"<div class=\"x\">hi</div>", TypeCode, "html"},
+		{"body {\n  color: red;\n}", TypeCode, "css"},
+		{"x = 1;\ny = 2;", TypeCode, ""},
+	}
+
+	for _, tt := range tests {
+		typ, lang := TypeOf(tt.text)
+		if typ != tt.wantType || lang != tt.wantLang {
+			t.Errorf("TypeOf(%q) = %q, %q, expected %q, %q", tt.text, typ, lang, tt.wantType, tt.wantLang)
+		}
+	}
+}
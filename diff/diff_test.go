@@ -0,0 +1,45 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "same\ntext", "same\ntext", ""},
+		{"single line", "hello", "hello world", "--- v1\n+++ v2\n@@ -1 +1 @@\n-hello\n+hello world\n"},
+		{"from empty", "", "new", "--- v1\n+++ v2\n@@ -0,0 +1 @@\n+new\n"},
+		{
+			"context",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10",
+			"1\n2\n3\n4\n5\nsix\n7\n8\n9\n10",
+			"--- v1\n+++ v2\n@@ -3,7 +3,7 @@\n 3\n 4\n 5\n-6\n+six\n 7\n 8\n 9\n",
+		},
+		{
+			"separate hunks",
+			"a\n1\n2\n3\n4\n5\n6\n7\n8\nb",
+			"A\n1\n2\n3\n4\n5\n6\n7\n8\nB",
+			"--- v1\n+++ v2\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Unified("v1", "v2", tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: Unified returned\n%s\nexpected\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedLarge(t *testing.T) {
+	a := strings.Repeat("line\n", 3000)
+	b := strings.Repeat("other\n", 3000)
+	got := Unified("v1", "v2", a, b)
+	if !strings.Contains(got, "@@ -1,3000 +1,3000 @@") {
+		t.Errorf("Expected large texts to be shown as replaced, got %.60q", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Package e2e implements the end-to-end encryption used for pastes. Content is
+// encrypted with a key derived from a room secret that never reaches the server.
+// The format matches the one produced by the browser with WebCrypto in web/index.js:
+//
+//	v2:<base64 salt>:<base64 IV>:<base64 AES-GCM ciphertext and tag>
+//
+// where the AES-256 key is derived from the secret and the salt with PBKDF2-SHA256.
+// Each key picks a random salt for the envelopes it seals, so keys cannot be
+// precomputed for every room at once.
+package e2e
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parameters of the key derivation, shared with the browser.
+const (
+	Iterations = 600000
+	SaltSize   = 16
+)
+
+const (
+	prefix   = "v2"
+	ivSize   = 12
+	tagSize  = 16
+	keyBytes = 32
+)
+
+// Anyone can seal envelopes with new salts, which each cost a slow derivation to open.
+// Keys for at most maxSaltedKeys other salts are kept, and new ones are derived at most
+// saltsPerSecond on average once the first maxSaltedKeys were.
+const (
+	maxSaltedKeys  = 8
+	saltsPerSecond = 1.0
+)
+
+var (
+	// ErrMalformed is returned for content that is not in the envelope format.
+	ErrMalformed = errors.New("e2e: malformed envelope")
+	// ErrTooManySalts is returned when envelopes with new salts are opened too quickly.
+	ErrTooManySalts = errors.New("e2e: too many envelopes with new salts, try again later")
+)
+
+// Key encrypts and decrypts pastes for one room secret. Keys for the salts of envelopes
+// sealed elsewhere are derived when they are first opened and the most recently used
+// ones are kept for the next ones.
+type Key struct {
+	secret string
+	salt   []byte
+	aead   cipher.AEAD
+
+	mu     sync.Mutex
+	salted []saltedKey
+	tokens float64
+	last   time.Time
+}
+
+type saltedKey struct {
+	salt string
+	aead cipher.AEAD
+}
+
+// DeriveKey derives the key for the room secret with a new random salt. Derivation is
+// deliberately slow, so keep the key around instead of deriving it for every paste.
+func DeriveKey(secret string) (*Key, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := derive(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{secret: secret, salt: salt, aead: aead, tokens: maxSaltedKeys, last: time.Now()}, nil
+}
+
+// derive derives the AES-GCM key for the secret and salt.
+func derive(secret string, salt []byte) (cipher.AEAD, error) {
+	raw, err := pbkdf2.Key(sha256.New, secret, salt, Iterations, keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts the plaintext into an envelope.
+func (k *Key) Seal(plaintext string) (string, error) {
+	iv := make([]byte, ivSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	ct := k.aead.Seal(nil, iv, []byte(plaintext), nil)
+	return strings.Join([]string{
+		prefix,
+		base64.StdEncoding.EncodeToString(k.salt),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(ct),
+	}, ":"), nil
+}
+
+// Open decrypts an envelope. It fails if the envelope was sealed with another secret.
+func (k *Key) Open(envelope string) (string, error) {
+	salt, iv, ct, err := parse(envelope)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := k.saltedKey(salt)
+	if err != nil {
+		return "", err
+	}
+	pt, err := aead.Open(nil, iv, ct, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// saltedKey returns the key of the room secret for the salt, deriving it the first time.
+func (k *Key) saltedKey(salt []byte) (cipher.AEAD, error) {
+	if string(salt) == string(k.salt) {
+		return k.aead, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for i, sk := range k.salted {
+		if sk.salt == string(salt) {
+			// Most recently used first
+			copy(k.salted[1:i+1], k.salted[:i])
+			k.salted[0] = sk
+			return sk.aead, nil
+		}
+	}
+
+	now := time.Now()
+	k.tokens = min(maxSaltedKeys, k.tokens+now.Sub(k.last).Seconds()*saltsPerSecond)
+	k.last = now
+	if k.tokens < 1 {
+		return nil, ErrTooManySalts
+	}
+	k.tokens--
+
+	aead, err := derive(k.secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.salted) < maxSaltedKeys {
+		k.salted = append(k.salted, saltedKey{})
+	}
+	copy(k.salted[1:], k.salted)
+	k.salted[0] = saltedKey{salt: string(salt), aead: aead}
+	return aead, nil
+}
+
+// Valid reports whether the content is a well-formed envelope. It does not need the key,
+// so the server can check pastes it cannot read.
+func Valid(envelope string) bool {
+	_, _, _, err := parse(envelope)
+	return err == nil
+}
+
+func parse(envelope string) (salt, iv, ct []byte, err error) {
+	parts := strings.Split(envelope, ":")
+	if len(parts) != 4 || parts[0] != prefix {
+		return nil, nil, nil, ErrMalformed
+	}
+
+	salt, err = base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(salt) != SaltSize {
+		return nil, nil, nil, ErrMalformed
+	}
+	iv, err = base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(iv) != ivSize {
+		return nil, nil, nil, ErrMalformed
+	}
+	ct, err = base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(ct) < tagSize {
+		return nil, nil, nil, ErrMalformed
+	}
+	return salt, iv, ct, nil
+}
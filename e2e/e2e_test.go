@@ -0,0 +1,124 @@
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testSecret = "correct horse battery staple"
+
+// browserEnvelope was produced by the WebCrypto code in web/index.js for "héllo from the browser".
+const browserEnvelope = "v2:EBESExQVFhcYGRobHB0eHw==:AAECAwQFBgcICQoL:XTDaBD3XHxEmS/OY8SOSZ/2O9bpC2YZBiGUSAXTORq3cUii8pCKV"
+
+func TestSealOpen(t *testing.T) {
+	key, err := DeriveKey(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+
+	envelope, err := key.Seal("hello world!")
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if !Valid(envelope) {
+		t.Errorf("Expected sealed envelope to be valid, got %v", envelope)
+	}
+
+	again, _ := key.Seal("hello world!")
+	if again == envelope {
+		t.Errorf("Expected every envelope to use a fresh IV")
+	}
+
+	pt, err := key.Open(envelope)
+	if err != nil || pt != "hello world!" {
+		t.Errorf("Expected to open the envelope, got %v %v", pt, err)
+	}
+
+	other, _ := DeriveKey("another secret")
+	if _, err := other.Open(envelope); err == nil {
+		t.Errorf("Expected opening with another secret to fail")
+	}
+}
+
+func TestSaltPerKey(t *testing.T) {
+	first, err := DeriveKey(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	second, err := DeriveKey(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+
+	a, _ := first.Seal("hello world!")
+	b, _ := second.Seal("hello world!")
+	if strings.Split(a, ":")[1] == strings.Split(b, ":")[1] {
+		t.Errorf("Expected keys to use their own salt, got %v and %v", a, b)
+	}
+
+	// Envelopes sealed with another salt open with the same secret
+	if pt, err := first.Open(b); err != nil || pt != "hello world!" {
+		t.Errorf("Expected to open an envelope with another salt, got %v %v", pt, err)
+	}
+}
+
+func TestSaltedKeysBounded(t *testing.T) {
+	key, err := DeriveKey(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	for i := range maxSaltedKeys {
+		key.salted = append(key.salted, saltedKey{salt: fmt.Sprint(i)})
+	}
+
+	sealer, _ := DeriveKey(testSecret)
+	envelope, _ := sealer.Seal("hello world!")
+	if pt, err := key.Open(envelope); err != nil || pt != "hello world!" {
+		t.Fatalf("Expected to open the envelope, got %v %v", pt, err)
+	}
+	if len(key.salted) != maxSaltedKeys || key.salted[0].salt != string(sealer.salt) {
+		t.Errorf("Expected the least recently used key to make room, got %v keys", len(key.salted))
+	}
+
+	// Known salts still open once new ones are refused
+	key.tokens = 0
+	if _, err := key.Open(envelope); err != nil {
+		t.Errorf("Expected a known salt to open, got %v", err)
+	}
+	other, _ := DeriveKey(testSecret)
+	next, _ := other.Seal("hello world!")
+	if _, err := key.Open(next); err != ErrTooManySalts {
+		t.Errorf("Expected a new salt to be refused, got %v", err)
+	}
+}
+
+func TestOpenBrowserEnvelope(t *testing.T) {
+	key, err := DeriveKey(testSecret)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+
+	pt, err := key.Open(browserEnvelope)
+	if err != nil || pt != "héllo from the browser" {
+		t.Errorf("Expected to open the browser envelope, got %v %v", pt, err)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, envelope := range []string{
+		"",
+		"hello world!",
+		"v2:AAECAwQFBgcICQoL:VypZ+ZfmxpDzwAGzaKc2O7E8IOLC5/RadTfBDl3BnhA3qPq+ZyPH",
+		"v1:EBESExQVFhcYGRobHB0eHw==:AAECAwQFBgcICQoL:XTDaBD3XHxEmS/OY8SOSZ/2O9bpC2YZBiGUSAXTORq3cUii8pCKV",
+		"v2:EBESExQV:AAECAwQFBgcICQoL:XTDaBD3XHxEmS/OY8SOSZ/2O9bpC2YZBiGUSAXTORq3cUii8pCKV",
+		"v1:AAECAwQF:VypZ+ZfmxpDzwAGzaKc2O7E8IOLC5/RadTfBDl3BnhA3qPq+ZyPH",
+		"v1:AAECAwQFBgcICQoL:short",
+		"v1:AAECAwQFBgcICQoL:not base64!",
+		"v1:AAECAwQFBgcICQoL:VypZ+ZfmxpDzwAGzaKc2O7E8IOLC5/RadTfBDl3BnhA3qPq+ZyPH",
+	} {
+		if Valid(envelope) {
+			t.Errorf("Expected %q to be invalid", envelope)
+		}
+	}
+}
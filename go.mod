@@ -8,3 +8,7 @@ require (
 )
 
 require github.com/mileusna/useragent v1.3.5
+
+require golang.org/x/crypto v0.45.0
+
+require golang.org/x/image v0.36.0
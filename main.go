@@ -13,6 +13,13 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("%s: %v\n", os.Args[1], err)
+		}
+		return
+	}
+
 	err := startServer()
 	if err != nil {
 		log.Fatalf("Failed to create server: %v\n", err)
@@ -24,6 +31,7 @@ func startServer() error {
 	if err != nil {
 		return err
 	}
+	defer pts.Close()
 
 	server := &http.Server{
 		Handler:      pts,
@@ -0,0 +1,66 @@
+// Package media processes attached images in pure Go.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ThumbnailSize is the longest side of thumbnails in pixels.
+const ThumbnailSize = 320
+
+// maxPixels bounds the size of images that are decoded, so a small file claiming huge
+// dimensions cannot exhaust memory.
+const maxPixels = 50_000_000
+
+// ErrTooLarge is returned for images with more than maxPixels pixels.
+var ErrTooLarge = errors.New("media: image dimensions too large")
+
+// Thumbnail decodes a PNG, JPEG, GIF or WebP image and returns a scaled down copy that
+// fits in ThumbnailSize. Images with transparency are encoded as PNG, others as JPEG.
+func Thumbnail(data []byte) ([]byte, error) {
+	img, format, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w > h {
+			w, h = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			w, h = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "png" || format == "gif" || format == "webp" && !dst.Opaque() {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	}
+	return buf.Bytes(), err
+}
+
+// decode decodes an image after checking its dimensions.
+func decode(data []byte) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+	return image.Decode(bytes.NewReader(data))
+}
@@ -0,0 +1,120 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for x := range 1000 {
+		src.Set(x, 250, color.RGBA{R: 255, A: 255})
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, src)
+	thumb, err := Thumbnail(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to create thumbnail: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || format != "png" || cfg.Width != ThumbnailSize || cfg.Height != ThumbnailSize/2 {
+		t.Errorf("Expected %vx%v png thumbnail, got %vx%v %v %v", ThumbnailSize, ThumbnailSize/2, cfg.Width, cfg.Height, format, err)
+	}
+
+	buf.Reset()
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 20)), nil)
+	thumb, err = Thumbnail(buf.Bytes())
+	cfg, format, _ = image.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || format != "jpeg" || cfg.Width != 10 || cfg.Height != 20 {
+		t.Errorf("Expected small jpeg to keep its size, got %vx%v %v %v", cfg.Width, cfg.Height, format, err)
+	}
+
+	if _, err := Thumbnail([]byte("not an image")); err == nil {
+		t.Errorf("Expected an error for data that is not an image")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for y := 5; y < 10; y++ {
+		for x := range 5 {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100})
+
+	// Insert an EXIF segment with orientation 6 (rotate 90° clockwise) after SOI
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00")
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo := append(append([]byte{0xFF, 0xD8}, segment...), buf.Bytes()[2:]...)
+	if o := exifOrientation(photo); o != 6 {
+		t.Fatalf("Expected orientation 6, got %v", o)
+	}
+
+	out, mime, err := Normalize(photo)
+	if err != nil || mime != "image/jpeg" {
+		t.Fatalf("Failed to normalize jpeg: %v %v", mime, err)
+	}
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Errorf("Expected EXIF to be stripped")
+	}
+	img, _, _ := image.Decode(bytes.NewReader(out))
+	if img.Bounds().Dx() != 10 || img.Bounds().Dy() != 20 {
+		t.Errorf("Expected rotated 10x20 image, got %v", img.Bounds())
+	}
+	// The red bottom left corner ends up in the top left corner
+	if r, g, _, _ := img.At(1, 1).RGBA(); r < 0x8000 || g > 0x8000 {
+		t.Errorf("Expected red top left corner, got %v", img.At(1, 1))
+	}
+
+	webp, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if out, mime, err := Normalize(webp); err != nil || mime != "image/png" || !bytes.HasPrefix(out, []byte("\x89PNG")) {
+		t.Errorf("Expected webp to become png, got %v %v", mime, err)
+	}
+
+	buf.Reset()
+	gif.Encode(&buf, src, nil)
+	if _, _, err := Normalize(buf.Bytes()); err != ErrUnsupported {
+		t.Errorf("Expected gif to be refused, got %v", err)
+	}
+}
+
+func TestExifOrientationMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)), nil)
+	body := buf.Bytes()[2:]
+
+	for name, prefix := range map[string][]byte{
+		"restart marker":   {0xFF, 0xD0},
+		"temporary marker": {0xFF, 0x01},
+		"fill bytes":       {0xFF, 0xFF, 0xFF},
+		"short length":     {0xFF, 0xE1, 0x00, 0x01},
+		"zero length":      {0xFF, 0xE1, 0x00, 0x00},
+		"truncated":        {0xFF, 0xE1},
+		"huge ifd offset":  append([]byte{0xFF, 0xE1, 0x00, 0x16}, []byte("Exif\x00\x00MM\x00*\xff\xff\xff\xff\x00\x00\x00\x00")...),
+	} {
+		data := append(append([]byte{0xFF, 0xD8}, prefix...), body...)
+		if o := exifOrientation(data); o != 0 {
+			t.Errorf("Expected no orientation with a %v, got %v", name, o)
+		}
+	}
+
+	// Standalone markers and fill bytes before the EXIF segment are skipped
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xD0, 0xFF, 0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, body...)
+	if o := exifOrientation(photo); o != 3 {
+		t.Errorf("Expected orientation 3, got %v", o)
+	}
+	if _, _, err := Normalize(photo); err != nil {
+		t.Errorf("Failed to normalize jpeg with a restart marker: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// ClipboardTypes are the image types accepted as clipboard images.
+var ClipboardTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+}
+
+// ErrUnsupported is returned for images that are not PNG, JPEG or WebP.
+var ErrUnsupported = errors.New("media: images must be PNG, JPEG or WebP")
+
+// Normalize decodes a PNG, JPEG or WebP image and encodes it again, which drops EXIF
+// and any other metadata. JPEG images are rotated upright according to their EXIF
+// orientation first. JPEG stays JPEG while PNG and WebP, which cannot be encoded in
+// pure Go, become PNG. It returns the new image and its type.
+func Normalize(data []byte) ([]byte, string, error) {
+	img, format, err := decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		img = orient(img, exifOrientation(data))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+		return buf.Bytes(), "image/jpeg", err
+	case "png", "webp":
+		err = png.Encode(&buf, img)
+		return buf.Bytes(), "image/png", err
+	}
+	return nil, "", ErrUnsupported
+}
+
+// orient applies an EXIF orientation to the image so that it displays upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the orientation tag of the EXIF data in a JPEG file, or 0 if
+// there is none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0
+	}
+
+	for i := 2; i+2 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before the marker
+			i++
+			continue
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD8:
+			// Standalone markers have no length
+			i += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA || i+4 > len(data):
+			return 0
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 0
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 0
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of TIFF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := order.Uint32(tiff[4:])
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+	ifd := int(offset)
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// maxRecentErrors is the number of errors kept for the admin dashboard.
+const maxRecentErrors = 100
+
+// errorLog keeps the most recent server errors in memory.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []errorEntry
+}
+
+type errorEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type adminClient struct {
+	presenceEntry
+	Network   string    `json:"network"`
+	Connected time.Time `json:"connected"`
+}
+
+type banRequest struct {
+	CIDR    string `json:"cidr"`
+	Reason  string `json:"reason"`
+	Minutes int    `json:"minutes"`
+}
+
+func (l *errorLog) add(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, errorEntry{Time: time.Now(), Message: msg})
+	if len(l.entries) > maxRecentErrors {
+		l.entries = l.entries[len(l.entries)-maxRecentErrors:]
+	}
+}
+
+// recent returns the logged errors, newest first.
+func (l *errorLog) recent() []errorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]errorEntry, len(l.entries))
+	for i, e := range l.entries {
+		entries[len(l.entries)-1-i] = e
+	}
+	return entries
+}
+
+// logError logs the error and keeps it for the admin dashboard.
+func (p *ptServer) logError(format string, v ...any) {
+	msg := fmt.Sprintf(format, v...)
+	log.Print(msg)
+	p.errors.add(strings.TrimSpace(msg))
+}
+
+// registerAdminRoutes adds the admin dashboard and API. They are only available
+// when an admin token is configured with ADMIN_TOKEN.
+func (p *ptServer) registerAdminRoutes() {
+	p.adminToken = os.Getenv("ADMIN_TOKEN")
+
+	p.serveMux.HandleFunc("GET /admin", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./web/admin.html")
+	})
+	p.serveMux.HandleFunc("GET /admin/api/networks", p.admin(p.adminNetworksHandler))
+	p.serveMux.HandleFunc("GET /admin/api/networks/{network}/pastes", p.admin(p.adminPastesHandler))
+	p.serveMux.HandleFunc("DELETE /admin/api/networks/{network}", p.admin(p.adminPurgeHandler))
+	p.serveMux.HandleFunc("DELETE /admin/api/pastes/{id}", p.admin(p.adminDeletePasteHandler))
+	p.serveMux.HandleFunc("GET /admin/api/clients", p.admin(p.adminClientsHandler))
+	p.serveMux.HandleFunc("GET /admin/api/bans", p.admin(p.adminBansHandler))
+	p.serveMux.HandleFunc("POST /admin/api/bans", p.admin(p.adminBanHandler))
+	p.serveMux.HandleFunc("DELETE /admin/api/bans/{id}", p.admin(p.adminUnbanHandler))
+	p.serveMux.HandleFunc("GET /admin/api/errors", p.admin(p.adminErrorsHandler))
+	p.serveMux.HandleFunc("GET /admin/api/backup", p.admin(p.adminBackupHandler))
+}
+
+// admin only calls the handler for requests carrying the admin token as a bearer token.
+func (p *ptServer) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(p.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func (p *ptServer) adminNetworksHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := p.dbm.NetworkStats()
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func (p *ptServer) adminPastesHandler(w http.ResponseWriter, r *http.Request) {
+	pastes, err := p.dbm.GetPastes(r.PathValue("network"))
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+	writeJSON(w, pastes)
+}
+
+func (p *ptServer) adminPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	network := r.PathValue("network")
+	n, err := p.dbm.PurgeNetwork(network)
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+
+	p.publishPastes(network)
+	writeJSON(w, map[string]int64{"deleted": n})
+}
+
+func (p *ptServer) adminDeletePasteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Pastes in the trash can be deleted for good too
+	network, err := p.dbm.PurgePaste(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+
+	p.publishPastes(network)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *ptServer) adminClientsHandler(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	clients := []adminClient{}
+	for c := range p.clients {
+		clients = append(clients, adminClient{presenceEntry: *c.presence(), Network: c.network, Connected: c.connected})
+	}
+	p.mu.Unlock()
+
+	writeJSON(w, clients)
+}
+
+func (p *ptServer) adminBansHandler(w http.ResponseWriter, r *http.Request) {
+	bans, err := p.dbm.GetBans()
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+	writeJSON(w, bans)
+}
+
+func (p *ptServer) adminBanHandler(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	cidr, err := normalizeCIDR(req.CIDR)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ban := data.Ban{CIDR: cidr, Reason: req.Reason, CreatedAt: time.Now()}
+	if req.Minutes > 0 {
+		expires := ban.CreatedAt.Add(time.Duration(req.Minutes) * time.Minute)
+		ban.ExpiresAt = &expires
+	}
+
+	ban.Id, err = p.ban(ban)
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+}
+
+func (p *ptServer) adminUnbanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := p.dbm.DeleteBan(id); err != nil {
+		p.adminError(w, err)
+		return
+	}
+	if err := p.reloadBans(); err != nil {
+		p.adminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *ptServer) adminErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, p.errors.recent())
+}
+
+func (p *ptServer) adminError(w http.ResponseWriter, err error) {
+	p.logError("admin request failed: %v\n", err)
+	http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+}
+
+// normalizeCIDR accepts a single IP address or a CIDR range and returns it in CIDR notation.
+func normalizeCIDR(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an IP address or CIDR range", s)
+	}
+	return ipNet.String(), nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/kuiadev/pastytext/data"
+)
+
+const testAdminToken = "test-admin-token"
+
+func TestAdminDisabled(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	w := adminRequest(server.Handler, http.MethodGet, "/admin/api/networks", "", testAdminToken)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code 404 without ADMIN_TOKEN, got %v", w.Code)
+	}
+}
+
+func TestAdminUnauthorized(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	for _, token := range []string{"", "wrong-token"} {
+		w := adminRequest(server.Handler, http.MethodGet, "/admin/api/networks", "", token)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code 401 for token %q, got %v", token, w.Code)
+		}
+	}
+}
+
+func TestAdminNetworks(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	pts.dbm.InsertPaste(data.Paste{Network: "10.0.0.1", Content: "first", CreatedAt: time.Now()})
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "10.0.0.1", Content: "second", CreatedAt: time.Now()})
+	pts.dbm.InsertPaste(data.Paste{Network: "10.0.0.2", Content: "other", CreatedAt: time.Now()})
+
+	w := adminRequest(server.Handler, http.MethodGet, "/admin/api/networks", "", testAdminToken)
+	var stats []data.NetworkStat
+	json.NewDecoder(w.Body).Decode(&stats)
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 networks, got %v", stats)
+	}
+
+	w = adminRequest(server.Handler, http.MethodDelete, "/admin/api/pastes/"+strconv.FormatInt(id, 10), "", testAdminToken)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code 204, got %v", w.Code)
+	}
+	w = adminRequest(server.Handler, http.MethodGet, "/admin/api/networks/10.0.0.1/pastes", "", testAdminToken)
+	var pastes []data.Paste
+	json.NewDecoder(w.Body).Decode(&pastes)
+	if len(pastes) != 1 || pastes[0].Content != "first" {
+		t.Errorf("Expected only the first paste to remain, got %v", pastes)
+	}
+
+	trashed, _ := pts.dbm.InsertPaste(data.Paste{Network: "10.0.0.1", Content: "trashed", CreatedAt: time.Now()})
+	pts.dbm.TrashPaste(trashed, "10.0.0.1", "BRAVE-OTTER", time.Now())
+	path := "/admin/api/pastes/" + strconv.FormatInt(trashed, 10)
+	if w := adminRequest(server.Handler, http.MethodDelete, path, "", testAdminToken); w.Code != http.StatusNoContent {
+		t.Errorf("Expected a paste in the trash to be deleted, got %v", w.Code)
+	}
+	if w := adminRequest(server.Handler, http.MethodDelete, path, "", testAdminToken); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a deleted paste not to be found, got %v", w.Code)
+	}
+
+	w = adminRequest(server.Handler, http.MethodDelete, "/admin/api/networks/10.0.0.1", "", testAdminToken)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":1`) {
+		t.Errorf("Expected purge to delete 1 paste, got %v %v", w.Code, w.Body.String())
+	}
+	if pastes, _ := pts.dbm.GetPastes("10.0.0.2"); len(pastes) != 1 {
+		t.Errorf("Expected other networks to be untouched")
+	}
+}
+
+func TestAdminClientsAndBans(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readEvent(t, ctx, c, "presence")
+
+	w := adminRequest(server.Handler, http.MethodGet, "/admin/api/clients", "", testAdminToken)
+	var clients []adminClient
+	json.NewDecoder(w.Body).Decode(&clients)
+	if len(clients) != 1 || clients[0].Name != "BRAVE-OTTER" || clients[0].Network != "127.0.0.1" {
+		t.Errorf("Expected the connected client to be listed, got %v", clients)
+	}
+
+	w = adminRequest(server.Handler, http.MethodPost, "/admin/api/bans", `{"cidr":"nonsense"}`, testAdminToken)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid ban to be refused, got %v", w.Code)
+	}
+
+	w = adminRequest(server.Handler, http.MethodPost, "/admin/api/bans", `{"cidr":"127.0.0.0/8","reason":"testing"}`, testAdminToken)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected ban to be created, got %v %v", w.Code, w.Body.String())
+	}
+	var ban data.Ban
+	json.NewDecoder(w.Body).Decode(&ban)
+
+	_, resp, err := websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{Subprotocols: []string{subprotocol}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected banned address to be refused, got %v", resp)
+	}
+
+	w = adminRequest(server.Handler, http.MethodDelete, "/admin/api/bans/"+strconv.FormatInt(ban.Id, 10), "", testAdminToken)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected ban to be lifted, got %v", w.Code)
+	}
+	c2, _, err := websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{Subprotocols: []string{subprotocol}})
+	if err != nil {
+		t.Errorf("Expected lifted ban to allow connections, got %v", err)
+	} else {
+		c2.CloseNow()
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	pts.logError("first error\n")
+	pts.logError("second error\n")
+
+	w := adminRequest(server.Handler, http.MethodGet, "/admin/api/errors", "", testAdminToken)
+	var errors []errorEntry
+	json.NewDecoder(w.Body).Decode(&errors)
+	if len(errors) != 2 || errors[0].Message != "second error" {
+		t.Errorf("Expected newest error first, got %v", errors)
+	}
+}
+
+func TestNormalizeCIDR(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":      "192.0.2.1/32",
+		"192.0.2.77/24":  "192.0.2.0/24",
+		"2001:db8::1":    "2001:db8::1/128",
+		" 10.0.0.0/8 ":   "10.0.0.0/8",
+		"not an address": "",
+	}
+	for in, want := range tests {
+		got, err := normalizeCIDR(in)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("normalizeCIDR(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+}
+
+func adminRequest(h http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
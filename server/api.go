@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// pastesHandler returns the pastes of the caller's network as JSON, optionally filtered
+// by the type and language query parameters, by tag parameters, which pastes must all
+// have, and by the ID of a collection. Secrets and one-time pastes are masked as they are on the websocket.
+func (p *ptServer) pastesHandler(w http.ResponseWriter, r *http.Request) {
+	filter := data.PasteFilter{
+		Type:     detect.ContentType(r.URL.Query().Get("type")),
+		Language: r.URL.Query().Get("language"),
+	}
+	if filter.Type != "" && !slices.Contains(detect.Types, filter.Type) {
+		http.Error(w, fmt.Sprintf("Unknown type %q, expected one of %v", filter.Type, detect.Types), http.StatusBadRequest)
+		return
+	}
+	for _, t := range r.URL.Query()["tag"] {
+		tag, err := data.NormalizeTag(t)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Tags = append(filter.Tags, tag)
+	}
+	if s := r.URL.Query().Get("collection"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		filter.Collection = id
+	}
+
+	pastes, err := p.dbm.FindPastes(p.getRequestIP(r), filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, maskPastes(pastes))
+}
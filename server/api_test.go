@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+)
+
+func TestPastesEndpoint(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	for _, content := range []string{"https://example.com", "jane@example.com", "Tr0ub4dor&3"} {
+		pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: content, CreatedAt: time.Now()})
+	}
+	pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "https://other.example", CreatedAt: time.Now()})
+
+	tests := []struct {
+		query string
+		code  int
+		want  []string
+	}{
+		{"", http.StatusOK, []string{"https://example.com", "jane@example.com", maskedContent}},
+		{"?type=url", http.StatusOK, []string{"https://example.com"}},
+		{"?type=secret", http.StatusOK, []string{maskedContent}},
+		{"?type=code&language=go", http.StatusOK, nil},
+		{"?type=bogus", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		w := authRequest(server.Handler, http.MethodGet, "/api/pastes"+tt.query, "", nil)
+		if w.Code != tt.code {
+			t.Errorf("GET /api/pastes%v returned %v, expected %v", tt.query, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		var pastes []data.Paste
+		json.NewDecoder(w.Body).Decode(&pastes)
+		var got []string
+		for _, p := range pastes {
+			got = append(got, p.Content)
+			if p.Type == "" {
+				t.Errorf("Expected paste %v to have a type", p.Id)
+			}
+		}
+		slices.Sort(got)
+		slices.Sort(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /api/pastes%v returned %v, expected %v", tt.query, got, tt.want)
+		}
+	}
+
+	var pastes []data.Paste
+	w := authRequest(server.Handler, http.MethodGet, "/api/pastes?type=email", "", nil)
+	json.NewDecoder(w.Body).Decode(&pastes)
+	if len(pastes) != 1 || pastes[0].Type != detect.TypeEmail {
+		t.Errorf("Expected the email paste, got %v", pastes)
+	}
+}
+
+func TestSettingsEndpoint(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	w := authRequest(server.Handler, http.MethodGet, "/api/settings", "", nil)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"dedup":true,"dedup_window":""}` {
+		t.Errorf("GET /api/settings returned %v %v, expected the defaults", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"dedup": true, "dedup_window": "1h"}`, http.StatusOK},
+		{`{"dedup": true, "dedup_window": "soon"}`, http.StatusBadRequest},
+		{`{"dedup": true, "dedup_window": "-1m"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := authRequest(server.Handler, http.MethodPut, "/api/settings", tt.body, nil); w.Code != tt.code {
+			t.Errorf("PUT /api/settings %v returned %v, expected %v", tt.body, w.Code, tt.code)
+		}
+	}
+
+	settings, _ := pts.dbm.GetSettings("192.0.2.1")
+	if !settings.Dedup || settings.DedupWindow != time.Hour {
+		t.Errorf("Expected settings to be saved, got %+v", settings)
+	}
+	if other, _ := pts.dbm.GetSettings("198.51.100.1"); other != data.DefaultSettings {
+		t.Errorf("Expected settings of other networks to be unchanged, got %+v", other)
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/media"
+)
+
+// defaultMaxAttachmentSize is the largest attachment accepted unless ATTACHMENT_MAX_SIZE is set.
+const defaultMaxAttachmentSize = 10 << 20
+
+// maxAttachmentName is the longest attachment file name kept, in bytes.
+const maxAttachmentName = 255
+
+// inlineTypes are the attachment types served inline, other files are always downloaded
+// so uploaded HTML or SVG cannot run scripts on this origin.
+var inlineTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errInvalidImage       = errors.New("image could not be decoded")
+)
+
+// newMaxAttachmentSize returns the largest attachment size in bytes from ATTACHMENT_MAX_SIZE.
+func newMaxAttachmentSize() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_SIZE"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxAttachmentSize
+}
+
+// storeAttachment sniffs the type of the file, creates a thumbnail for images and
+// stores it as a paste of the network.
+func (p *ptServer) storeAttachment(paste data.Paste, name string, file []byte) (data.Paste, error) {
+	if int64(len(file)) > p.maxAttachment {
+		return paste, errAttachmentTooLarge
+	}
+
+	a := &data.Attachment{Name: attachmentName(name), Mime: http.DetectContentType(file)}
+	var thumbnail []byte
+	if a.Image() {
+		var err error
+		if thumbnail, err = media.Thumbnail(file); err != nil {
+			thumbnail = nil
+		}
+	}
+
+	paste.Attachment = a
+	paste.CreatedAt = time.Now()
+	return p.dbm.InsertAttachment(paste, file, thumbnail)
+}
+
+// storeClipboardImage stores an image pasted from the clipboard. The image is decoded and
+// encoded again to strip EXIF and other metadata, which may include the location where
+// a photo was taken.
+func (p *ptServer) storeClipboardImage(paste data.Paste, name string, img []byte) (data.Paste, error) {
+	if int64(len(img)) > p.maxAttachment {
+		return paste, errAttachmentTooLarge
+	}
+	if !media.ClipboardTypes[http.DetectContentType(img)] {
+		return paste, media.ErrUnsupported
+	}
+
+	normalized, mimeType, err := media.Normalize(img)
+	if err != nil {
+		return paste, errInvalidImage
+	}
+
+	if name == "" {
+		name = "pasted-image-" + time.Now().Format("20060102-150405")
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if mimeType == "image/png" {
+		name += ".png"
+	} else {
+		name += ".jpg"
+	}
+	return p.storeAttachment(paste, name, normalized)
+}
+
+// clientError reports whether an error storing an attachment was caused by the client.
+func clientError(err error) bool {
+	return errors.Is(err, errAttachmentTooLarge) || errors.Is(err, errInvalidImage) || errors.Is(err, media.ErrUnsupported)
+}
+
+// attachmentName returns a file name safe to send back in a Content-Disposition header.
+func attachmentName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if len(name) > maxAttachmentName {
+		name = name[:maxAttachmentName]
+	}
+	return strings.ToValidUTF8(name, "_")
+}
+
+// parseBinaryMessage reads an attachment sent in a binary websocket frame: a JSON
+// message such as {"action":"upload","text":"file name"}, a newline and the file.
+// Images pasted from the clipboard use the action "image".
+func parseBinaryMessage(b []byte) (clientMessage, error) {
+	var msg clientMessage
+	header, file, ok := bytes.Cut(b, []byte("\n"))
+	if !ok {
+		return msg, errors.New("binary message without header")
+	}
+	if err := json.Unmarshal(header, &msg); err != nil {
+		return msg, err
+	}
+	msg.Data = file
+	return msg, nil
+}
+
+// uploadHandler stores the file of a multipart upload, in the field "file", as a paste
+// of the caller's network. The optional field "user" names the uploading device.
+func (p *ptServer) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, p.maxAttachment+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, errAttachmentTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	b, err := io.ReadAll(io.LimitReader(file, p.maxAttachment+1))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := p.validateName(r.FormValue("user"))
+	if err != nil {
+		user = "anonymous"
+	}
+
+	network := p.getRequestIP(r)
+	paste, err := p.storeAttachment(data.Paste{Network: network, User: user, Device: deviceName(r)}, header.Filename, b)
+	if errors.Is(err, errAttachmentTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		p.logError("error storing attachment: %v\n", err)
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	p.publishPastes(network)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(paste)
+}
+
+// downloadHandler serves an attachment of the caller's network.
+func (p *ptServer) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	a, file, err := p.dbm.GetAttachment(id, p.getRequestIP(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	disposition := "attachment"
+	if inlineTypes[a.Mime] && r.URL.Query().Has("inline") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", a.Mime)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(file)
+}
+
+// thumbnailHandler serves the thumbnail of an image attachment of the caller's network.
+func (p *ptServer) thumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	thumbnail, err := p.dbm.GetThumbnail(id, p.getRequestIP(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(thumbnail))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(thumbnail)
+}
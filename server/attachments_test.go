@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+)
+
+func TestUploadAttachment(t *testing.T) {
+	t.Setenv("ATTACHMENT_MAX_SIZE", "4096")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 20, 10)))
+
+	w := uploadRequest(server.Handler, "../../shot.png", img.Bytes())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected upload to succeed, got %v %v", w.Code, w.Body.String())
+	}
+	var paste data.Paste
+	json.NewDecoder(w.Body).Decode(&paste)
+	a := paste.Attachment
+	if a == nil || a.Name != "shot.png" || a.Mime != "image/png" || !a.Thumbnail || paste.Type != detect.TypeImage {
+		t.Fatalf("Expected image paste, got %+v %+v", paste, a)
+	}
+
+	w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/attachments/%d", a.Id), "", nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), img.Bytes()) || w.Header().Get("Content-Disposition") != `attachment; filename=shot.png` {
+		t.Errorf("Expected attachment download, got %v %v", w.Code, w.Header())
+	}
+
+	w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/attachments/%d/thumbnail", a.Id), "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected thumbnail, got %v %v", w.Code, w.Header())
+	}
+
+	// HTML is never served inline
+	w = uploadRequest(server.Handler, "page.html", []byte("<html><script>alert(1)</script></html>"))
+	json.NewDecoder(w.Body).Decode(&paste)
+	w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/attachments/%d?inline", paste.Attachment.Id), "", nil)
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" || w.Header().Get("Content-Disposition") != "attachment; filename=page.html" {
+		t.Errorf("Expected html to be downloaded, got %v %v", ct, w.Header().Get("Content-Disposition"))
+	}
+
+	w = uploadRequest(server.Handler, "big.bin", make([]byte, 5000))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected too large upload to be refused, got %v", w.Code)
+	}
+
+	// Attachments of other networks are not found
+	other, _ := pts.dbm.InsertAttachment(data.Paste{Network: "198.51.100.1", CreatedAt: time.Now(), Attachment: &data.Attachment{Name: "x.txt", Mime: "text/plain"}}, []byte("x"), nil)
+	for _, path := range []string{"/api/attachments/%d", "/api/attachments/%d/thumbnail"} {
+		w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf(path, other.Attachment.Id), "", nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected attachment of another network to be hidden, got %v", w.Code)
+		}
+	}
+}
+
+func TestBinaryUpload(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	frame := append([]byte(`{"action":"upload","text":"notes.txt"}`+"\n"), []byte("hello file")...)
+	if err := c.Write(ctx, websocket.MessageBinary, frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 1 || pastes[0].Attachment == nil || pastes[0].Attachment.Size != 10 || pastes[0].User != "BRAVE-OTTER" || pastes[0].Type != detect.TypeFile {
+		t.Errorf("Expected file paste, got %+v", pastes)
+	}
+}
+
+func TestCrossOriginUpload(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "planted.txt")
+	fw.Write([]byte("from another site"))
+	mw.Close()
+
+	w := crossSiteRequest(server.Handler, http.MethodPost, "/api/attachments", mw.FormDataContentType(), body.String())
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a cross-origin upload to be refused, got %v", w.Code)
+	}
+	if pastes, _ := pts.dbm.GetPastes("192.0.2.1"); len(pastes) != 0 {
+		t.Errorf("Expected nothing to be uploaded, got %v", pastes)
+	}
+}
+
+func uploadRequest(h http.Handler, name string, file []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", name)
+	fw.Write(file)
+	mw.WriteField("user", "BRAVE-OTTER")
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/attachments", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestClipboardImage(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	var img bytes.Buffer
+	jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 20, 10)), nil)
+	exif := []byte("Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x00GPS 52.37N 4.89E")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, img.Bytes()[2:]...)
+
+	frame := append([]byte(`{"action":"image"}`+"\n"), photo...)
+	if err := c.Write(ctx, websocket.MessageBinary, frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 1 || pastes[0].Type != detect.TypeImage || pastes[0].Attachment == nil {
+		t.Fatalf("Expected image paste, got %+v", pastes)
+	}
+	a := pastes[0].Attachment
+	if a.Mime != "image/jpeg" || !strings.HasPrefix(a.Name, "pasted-image-") || !strings.HasSuffix(a.Name, ".jpg") || !a.Thumbnail {
+		t.Errorf("Expected normalized jpeg, got %+v", a)
+	}
+	_, file, _ := pts.dbm.GetAttachment(a.Id, "127.0.0.1")
+	if bytes.Contains(file, []byte("GPS")) || bytes.Contains(file, []byte("Exif")) {
+		t.Errorf("Expected EXIF to be stripped")
+	}
+
+	for _, payload := range [][]byte{[]byte("plain text"), append([]byte("\x89PNG\r\n\x1a\n"), "broken"...)} {
+		frame := append([]byte(`{"action":"image"}`+"\n"), payload...)
+		if err := c.Write(ctx, websocket.MessageBinary, frame); err != nil {
+			t.Fatalf("Failed to write frame: %v", err)
+		}
+		readEvent(t, ctx, c, "error")
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionCookie is the name of the cookie holding a signed network session.
+const sessionCookie = "pt_session"
+
+// sessionLifetime is how long a session stays valid after entering the passphrase.
+const sessionLifetime = time.Hour * 24 * 30
+
+// minPassphraseLength is the shortest passphrase accepted when claiming a network.
+const minPassphraseLength = 8
+
+// Brute-force protection: after maxAuthFailures wrong passphrases within lockoutDuration
+// the network is locked out for lockoutDuration.
+const (
+	maxAuthFailures = 5
+	lockoutDuration = time.Minute * 15
+)
+
+// accessControl implements the opt-in passphrase protection of networks.
+type accessControl struct {
+	enabled bool
+	key     []byte
+
+	mu       sync.Mutex
+	failures map[string]*authFailures
+}
+
+type authFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+type passphraseRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// newAccessControl enables passphrase protection when ACCESS_CONTROL is true. Sessions are
+// signed with SESSION_KEY, or with a random key if it is not set, in which case sessions
+// do not survive a restart.
+func newAccessControl() (*accessControl, error) {
+	ac := &accessControl{failures: make(map[string]*authFailures)}
+	ac.enabled, _ = strconv.ParseBool(os.Getenv("ACCESS_CONTROL"))
+
+	if secret := os.Getenv("SESSION_KEY"); secret != "" {
+		key := sha256.Sum256([]byte(secret))
+		ac.key = key[:]
+	} else {
+		ac.key = make([]byte, 32)
+		if _, err := rand.Read(ac.key); err != nil {
+			return nil, err
+		}
+		if ac.enabled {
+			log.Printf("SESSION_KEY not set, sessions will not survive a restart\n")
+		}
+	}
+
+	return ac, nil
+}
+
+// requiresAuth reports whether the path only serves authenticated clients on protected networks.
+func requiresAuth(path string) bool {
+	return path == "/ws" || strings.HasPrefix(path, "/api/")
+}
+
+// authorized reports whether the request may access the data of its network.
+func (p *ptServer) authorized(r *http.Request) (bool, error) {
+	if !p.access.enabled {
+		return true, nil
+	}
+
+	network := p.getRequestIP(r)
+	since, err := p.dbm.ProtectedSince(network)
+	if err != nil || since.IsZero() {
+		return err == nil, err
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false, nil
+	}
+	return p.access.verify(cookie.Value, network, since), nil
+}
+
+// authHandler reports the protection status of the caller's network.
+func (p *ptServer) authHandler(w http.ResponseWriter, r *http.Request) {
+	network := p.getRequestIP(r)
+	status := struct {
+		Enabled       bool `json:"enabled"`
+		Protected     bool `json:"protected"`
+		Authenticated bool `json:"authenticated"`
+	}{Enabled: p.access.enabled}
+
+	if p.access.enabled {
+		since, err := p.dbm.ProtectedSince(network)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		status.Protected = !since.IsZero()
+		status.Authenticated, _ = p.authorized(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// loginHandler exchanges the network passphrase for a session cookie.
+func (p *ptServer) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if !p.access.enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	network := p.getRequestIP(r)
+	if wait := p.access.lockedFor(network); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+		return
+	}
+
+	var req passphraseRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := p.dbm.CheckPassphrase(network, req.Passphrase)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		p.access.fail(network)
+		http.Error(w, "Wrong passphrase", http.StatusUnauthorized)
+		return
+	}
+
+	p.access.reset(network)
+	p.setSession(w, r, network)
+}
+
+// claimHandler protects the caller's network with a passphrase. An already protected
+// network can only have its passphrase changed by an authenticated client.
+func (p *ptServer) claimHandler(w http.ResponseWriter, r *http.Request) {
+	if !p.access.enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	ok, err := p.authorized(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Network is already protected", http.StatusForbidden)
+		return
+	}
+
+	var req passphraseRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if len(req.Passphrase) < minPassphraseLength || len(req.Passphrase) > 72 {
+		http.Error(w, fmt.Sprintf("Passphrase must be between %d and 72 characters", minPassphraseLength), http.StatusBadRequest)
+		return
+	}
+
+	network := p.getRequestIP(r)
+	if err := p.dbm.SetPassphrase(network, req.Passphrase); err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	p.setSession(w, r, network)
+}
+
+// logoutHandler clears the session cookie.
+func (p *ptServer) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setSession issues a session cookie for the network.
+func (p *ptServer) setSession(w http.ResponseWriter, r *http.Request, network string) {
+	since, err := p.dbm.ProtectedSince(network)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	expires := time.Now().Add(sessionLifetime)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    p.access.sign(network, since, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   p.secureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// secureRequest reports whether the request was made over HTTPS, directly or through a
+// trusted proxy, so cookies issued to it can be marked secure.
+func (p *ptServer) secureRequest(r *http.Request) bool {
+	return r.TLS != nil || (p.fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+// sign creates a session token for the network. The time the passphrase was set is part of
+// the signature so changing the passphrase invalidates existing sessions.
+func (ac *accessControl) sign(network string, since, expires time.Time) string {
+	payload := fmt.Sprintf("%s|%d|%d", network, since.UnixNano(), expires.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(ac.mac(payload))
+}
+
+// verify checks the session token is valid for the network and has not expired.
+func (ac *accessControl) verify(token, network string, since time.Time) bool {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, ac.mac(string(payload))) {
+		return false
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 || parts[0] != network || parts[1] != strconv.FormatInt(since.UnixNano(), 10) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	return err == nil && time.Now().Unix() < expires
+}
+
+func (ac *accessControl) mac(payload string) []byte {
+	h := hmac.New(sha256.New, ac.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// lockedFor returns how long the network is still locked out.
+func (ac *accessControl) lockedFor(network string) time.Duration {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if f, ok := ac.failures[network]; ok {
+		return time.Until(f.lockedUntil)
+	}
+	return 0
+}
+
+// fail records a wrong passphrase and locks the network out once there were too many.
+func (ac *accessControl) fail(network string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := time.Now()
+	f, ok := ac.failures[network]
+	if !ok || now.Sub(f.first) > lockoutDuration {
+		f = &authFailures{first: now}
+		ac.failures[network] = f
+	}
+	f.count++
+	if f.count >= maxAuthFailures {
+		f.lockedUntil = now.Add(lockoutDuration)
+		f.count = 0
+		f.first = f.lockedUntil
+	}
+}
+
+// reset forgets the failed attempts of the network.
+func (ac *accessControl) reset(network string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	delete(ac.failures, network)
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestAccessControlDisabled(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	w := authRequest(server.Handler, http.MethodGet, "/auth", "", nil)
+	var status map[string]bool
+	json.NewDecoder(w.Body).Decode(&status)
+	if status["enabled"] {
+		t.Errorf("Expected access control to be disabled by default")
+	}
+
+	w = authRequest(server.Handler, http.MethodPost, "/auth", `{"passphrase":"whatever"}`, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code 404, got %v", w.Code)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	t.Setenv("ACCESS_CONTROL", "true")
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// Unprotected networks work as before
+	c, _, err := websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{Subprotocols: []string{subprotocol}})
+	if err != nil {
+		t.Fatalf("Expected unprotected network to accept websocket, got %v", err)
+	}
+	c.CloseNow()
+
+	w := authRequest(server.Handler, http.MethodPost, "/auth/claim", `{"passphrase":"short"}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected short passphrase to be refused, got %v", w.Code)
+	}
+
+	w = authRequest(server.Handler, http.MethodPost, "/auth/claim", `{"passphrase":"correct horse"}`, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected claim to succeed, got %v", w.Code)
+	}
+	session := w.Result().Cookies()[0]
+
+	w = authRequest(server.Handler, http.MethodPost, "/auth/claim", `{"passphrase":"stolen network"}`, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected claim of protected network without session to be refused, got %v", w.Code)
+	}
+
+	// The httptest server sees requests from 127.0.0.1, claim that network too
+	resp, err := http.Post(s.URL+"/auth/claim", "application/json", strings.NewReader(`{"passphrase":"correct horse"}`))
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected claim to succeed, got %v %v", resp, err)
+	}
+	wsSession := resp.Cookies()[0]
+
+	_, resp, err = websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{Subprotocols: []string{subprotocol}})
+	if err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected websocket without session to be refused, got %v", resp)
+	}
+
+	header := http.Header{}
+	header.Set("Cookie", wsSession.String())
+	c, _, err = websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{Subprotocols: []string{subprotocol}, HTTPHeader: header})
+	if err != nil {
+		t.Fatalf("Expected websocket with session to be accepted, got %v", err)
+	}
+	c.CloseNow()
+
+	w = authRequest(server.Handler, http.MethodGet, "/auth", "", session)
+	var status map[string]bool
+	json.NewDecoder(w.Body).Decode(&status)
+	if !status["protected"] || !status["authenticated"] {
+		t.Errorf("Expected protected and authenticated status, got %v", status)
+	}
+
+	w = authRequest(server.Handler, http.MethodPost, "/auth", `{"passphrase":"correct horse"}`, nil)
+	if w.Code != http.StatusNoContent || len(w.Result().Cookies()) == 0 {
+		t.Errorf("Expected login to succeed, got %v", w.Code)
+	}
+
+	// Changing the passphrase invalidates existing sessions
+	w = authRequest(server.Handler, http.MethodPost, "/auth/claim", `{"passphrase":"battery staple"}`, session)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected passphrase change to succeed, got %v", w.Code)
+	}
+	w = authRequest(server.Handler, http.MethodGet, "/auth", "", session)
+	json.NewDecoder(w.Body).Decode(&status)
+	if status["authenticated"] {
+		t.Errorf("Expected old session to be invalid after passphrase change")
+	}
+}
+
+func TestAccessControlLockout(t *testing.T) {
+	t.Setenv("ACCESS_CONTROL", "true")
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	w := authRequest(server.Handler, http.MethodPost, "/auth/claim", `{"passphrase":"correct horse"}`, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected claim to succeed, got %v", w.Code)
+	}
+
+	for range maxAuthFailures {
+		w = authRequest(server.Handler, http.MethodPost, "/auth", `{"passphrase":"wrong horse"}`, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code 401, got %v", w.Code)
+		}
+	}
+
+	w = authRequest(server.Handler, http.MethodPost, "/auth", `{"passphrase":"correct horse"}`, nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected locked out network to get status code 429, got %v", w.Code)
+	}
+}
+
+func TestClaimForwardedNetwork(t *testing.T) {
+	t.Setenv("ACCESS_CONTROL", "true")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	claim := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/claim", strings.NewReader(`{"passphrase":"correct horse"}`))
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Only a trusted proxy can claim the network of the client it forwards for
+	if w := claim("192.0.2.1:1234"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected claim to succeed, got %v", w.Code)
+	}
+	if since, _ := pts.dbm.ProtectedSince("198.51.100.7"); !since.IsZero() {
+		t.Errorf("Expected the forwarded network not to be claimed by an untrusted client")
+	}
+	if since, _ := pts.dbm.ProtectedSince("192.0.2.1"); since.IsZero() {
+		t.Errorf("Expected the network of the client to be claimed")
+	}
+
+	w := claim("10.0.0.1:1234")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected claim through the proxy to succeed, got %v", w.Code)
+	}
+	if since, _ := pts.dbm.ProtectedSince("198.51.100.7"); since.IsZero() {
+		t.Errorf("Expected the forwarded network to be claimed through the proxy")
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+	ac := &accessControl{key: []byte("test-key")}
+	since := time.Now()
+
+	token := ac.sign("test-network", since, time.Now().Add(time.Minute))
+	if !ac.verify(token, "test-network", since) {
+		t.Errorf("Expected token to be valid")
+	}
+	if ac.verify(token, "other-network", since) {
+		t.Errorf("Expected token to be invalid for another network")
+	}
+	if ac.verify(token+"x", "test-network", since) {
+		t.Errorf("Expected tampered token to be invalid")
+	}
+
+	expired := ac.sign("test-network", since, time.Now().Add(-time.Minute))
+	if ac.verify(expired, "test-network", since) {
+		t.Errorf("Expected expired token to be invalid")
+	}
+}
+
+func authRequest(h http.Handler, method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
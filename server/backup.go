@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Scheduled backups are made every defaultBackupInterval and the newest defaultBackupKeep
+// are kept, unless BACKUP_INTERVAL and BACKUP_KEEP say otherwise.
+const (
+	defaultBackupInterval = 24 * time.Hour
+	defaultBackupKeep     = 7
+)
+
+// backupSchedule describes the periodic backups made into a directory.
+type backupSchedule struct {
+	dir      string
+	interval time.Duration
+	keep     int
+}
+
+// newBackupSchedule returns the backup schedule from BACKUP_DIR, BACKUP_INTERVAL and
+// BACKUP_KEEP. Without BACKUP_DIR no backups are scheduled.
+func newBackupSchedule() backupSchedule {
+	s := backupSchedule{
+		dir:      os.Getenv("BACKUP_DIR"),
+		interval: defaultBackupInterval,
+		keep:     defaultBackupKeep,
+	}
+	if d, err := time.ParseDuration(os.Getenv("BACKUP_INTERVAL")); err == nil && d > 0 {
+		s.interval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("BACKUP_KEEP")); err == nil && n > 0 {
+		s.keep = n
+	}
+	return s
+}
+
+// startBackups periodically backs up the database into the backup directory.
+func (p *ptServer) startBackups() {
+	if p.backups.dir == "" {
+		return
+	}
+
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+
+		ticker := time.NewTicker(p.backups.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				path, err := p.dbm.BackupTo(p.backups.dir, p.backups.keep)
+				if err != nil {
+					p.logError("error backing up database: %v\n", err)
+					continue
+				}
+				log.Printf("database backed up to %s\n", path)
+			}
+		}
+	}()
+}
+
+// adminBackupHandler downloads a consistent snapshot of the whole database.
+func (p *ptServer) adminBackupHandler(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "pastytext-backup")
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pastytext.db")
+	if err := p.dbm.Backup(path); err != nil {
+		p.adminError(w, err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		p.adminError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="pastytext-%s.db"`, time.Now().UTC().Format("20060102-150405")))
+	io.Copy(w, f)
+}
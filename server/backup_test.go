@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestAdminBackup(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	pts.dbm.InsertPaste(data.Paste{Network: "10.0.0.1", Content: "backed up", CreatedAt: time.Now()})
+
+	if w := adminRequest(server.Handler, http.MethodGet, "/admin/api/backup", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected backup without token to be refused, got %v", w.Code)
+	}
+
+	w := adminRequest(server.Handler, http.MethodGet, "/admin/api/backup", "", testAdminToken)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".db") {
+		t.Fatalf("Expected a database download, got %v %v", w.Code, w.Header())
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	os.WriteFile(path, w.Body.Bytes(), 0600)
+	if _, err := data.CheckBackup(path); err != nil {
+		t.Errorf("Expected a valid backup, got %v", err)
+	}
+}
+
+func TestScheduledBackups(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("BACKUP_DIR", dir)
+	t.Setenv("BACKUP_INTERVAL", "20ms")
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if backups, _ := filepath.Glob(filepath.Join(dir, "pastytext-*.db")); len(backups) > 0 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("Expected backups to be made into BACKUP_DIR")
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/kuiadev/pastytext/data"
+)
+
+// banList caches the active bans so every request can be checked without a query.
+type banList struct {
+	mu   sync.RWMutex
+	bans []activeBan
+}
+
+type activeBan struct {
+	ipNet   *net.IPNet
+	expires *time.Time
+}
+
+// contains reports whether the address falls in any unexpired ban.
+func (l *banList) contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	for _, b := range l.bans {
+		if (b.expires == nil || b.expires.After(now)) && b.ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBanned reports whether the address falls in any active ban.
+func (p *ptServer) isBanned(addr string) bool {
+	return p.bans.contains(addr)
+}
+
+// bannable reports whether requests to the path are refused for banned addresses.
+// The admin area stays reachable so an operator can lift a ban on themselves.
+func bannable(path string) bool {
+	return path != "/admin" && !strings.HasPrefix(path, "/admin/")
+}
+
+// reloadBans drops expired bans from the database and refreshes the cached list.
+func (p *ptServer) reloadBans() error {
+	if _, err := p.dbm.DeleteExpiredBans(time.Now()); err != nil {
+		return err
+	}
+
+	bans, err := p.dbm.GetBans()
+	if err != nil {
+		return err
+	}
+
+	active := make([]activeBan, 0, len(bans))
+	for _, b := range bans {
+		_, ipNet, err := net.ParseCIDR(b.CIDR)
+		if err != nil {
+			p.logError("ignoring invalid ban %q: %v\n", b.CIDR, err)
+			continue
+		}
+		active = append(active, activeBan{ipNet: ipNet, expires: b.ExpiresAt})
+	}
+
+	p.bans.mu.Lock()
+	p.bans.bans = active
+	p.bans.mu.Unlock()
+	return nil
+}
+
+// ban stores the ban, starts enforcing it and disconnects clients it covers.
+func (p *ptServer) ban(b data.Ban) (int64, error) {
+	id, err := p.dbm.InsertBan(b)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.reloadBans(); err != nil {
+		return id, err
+	}
+
+	p.disconnectBanned()
+	return id, nil
+}
+
+// disconnectBanned closes the websocket of every connected client that is now banned.
+func (p *ptServer) disconnectBanned() {
+	p.mu.Lock()
+	var banned []*client
+	for c := range p.clients {
+		if p.isBanned(c.network) {
+			banned = append(banned, c)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, c := range banned {
+		go c.conn.Close(websocket.StatusPolicyViolation, "banned")
+	}
+}
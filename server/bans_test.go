@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestBanEnforcedOnAllRoutes(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	if _, err := pts.ban(data.Ban{CIDR: "192.0.2.0/24", Reason: "testing", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+
+	for _, path := range []string{"/", "/index.html", "/id", "/ws"} {
+		w := adminRequest(server.Handler, http.MethodGet, path, "", "")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code 403 for %v, got %v", path, w.Code)
+		}
+	}
+
+	w := adminRequest(server.Handler, http.MethodGet, "/admin/api/bans", "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected admin API to stay reachable for banned addresses, got %v", w.Code)
+	}
+}
+
+func TestExpiredBan(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	expired := time.Now().Add(-time.Minute)
+	if _, err := pts.ban(data.Ban{CIDR: "192.0.2.1/32", CreatedAt: time.Now().Add(-time.Hour), ExpiresAt: &expired}); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+
+	w := adminRequest(server.Handler, http.MethodGet, "/id", "", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected expired ban not to be enforced, got %v", w.Code)
+	}
+
+	if bans, _ := pts.dbm.GetBans(); len(bans) != 0 {
+		t.Errorf("Expected expired ban to be removed, got %v", bans)
+	}
+}
+
+func TestBanClosesConnections(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readEvent(t, ctx, c, "presence")
+
+	if _, err := pts.ban(data.Ban{CIDR: "127.0.0.1/32", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+
+	for {
+		_, _, err := c.Read(ctx)
+		if err == nil {
+			continue
+		}
+		var closeErr websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.StatusPolicyViolation {
+			t.Errorf("Expected connection to be closed with a policy violation, got %v", err)
+		}
+		break
+	}
+}
+
+func TestAutomaticBan(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "0.001")
+	t.Setenv("RATE_BURST", "2")
+	t.Setenv("AUTO_BAN_TRIPS", "1")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	for _, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusForbidden} {
+		w := adminRequest(server.Handler, http.MethodGet, "/id", "", "")
+		if w.Code != want {
+			t.Errorf("Expected status code %v, got %v", want, w.Code)
+		}
+	}
+
+	bans, _ := pts.dbm.GetBans()
+	if len(bans) != 1 || bans[0].CIDR != "192.0.2.1/32" || bans[0].ExpiresAt == nil {
+		t.Errorf("Expected a temporary ban of the client, got %v", bans)
+	}
+}
+
+func TestIPv6Ban(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	if _, err := pts.ban(data.Ban{CIDR: "2001:db8::/32", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+
+	for remote, want := range map[string]int{
+		"[2001:db8::1]:1234":    http.StatusForbidden,
+		"[2001:db8:ff::7]:1234": http.StatusForbidden,
+		"[2001:db9::1]:1234":    http.StatusOK,
+		"192.0.2.1:1234":        http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/id", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Expected status code %v for %v, got %v", want, remote, w.Code)
+		}
+	}
+}
+
+func TestBanIgnoresForwardedFor(t *testing.T) {
+	t.Setenv("RATE_LIMIT", "0.001")
+	t.Setenv("RATE_BURST", "1")
+	t.Setenv("AUTO_BAN_TRIPS", "1")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	if _, err := pts.ban(data.Ban{CIDR: "192.0.2.1/32", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+
+	// A client that is not a trusted proxy can neither escape its ban nor get another
+	// address banned by claiming to forward for it
+	req := httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected the ban to apply whatever X-Forwarded-For says, got %v", w.Code)
+	}
+
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/id", nil)
+		req.RemoteAddr = "[2001:db8::1]:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	banned := map[string]bool{}
+	bans, _ := pts.dbm.GetBans()
+	for _, b := range bans {
+		banned[b.CIDR] = true
+	}
+	if len(bans) != 2 || !banned["2001:db8::1/128"] {
+		t.Errorf("Expected the IPv6 client itself to be banned automatically, got %v", bans)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// confirmTimeout is how long a bulk deletion can be confirmed after it was requested.
+const confirmTimeout = time.Minute
+
+// maxBulkIds is the most pastes delete_many deletes at once.
+const maxBulkIds = 1000
+
+// errConfirmRequired is returned by bulkDelete until the deletion is confirmed.
+var errConfirmRequired = errors.New("confirmation required")
+
+// bulkRequest is a bulk deletion of pastes of a network.
+type bulkRequest struct {
+	action  string
+	network string
+	sel     data.Selection
+}
+
+// key identifies the request, so that a confirmation only applies to the deletion it
+// was issued for.
+func (b bulkRequest) key() string {
+	return fmt.Sprintf("%s|%s|%v|%d", b.action, b.network, b.sel.Ids, b.sel.Before.UnixNano())
+}
+
+// bulkResult tells how many pastes a bulk deletion deleted, or would delete with the
+// confirmation token when one is required.
+type bulkResult struct {
+	Count   int     `json:"count"`
+	Ids     []int64 `json:"ids,omitempty"`
+	Confirm string  `json:"confirm,omitempty"`
+}
+
+// confirmations holds the tokens that confirm bulk deletions. Tokens are single use.
+type confirmations struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	key     string
+	expires time.Time
+}
+
+// issue returns a new token confirming the request with the given key.
+func (c *confirmations) issue(key string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.pending == nil {
+		c.pending = make(map[string]pendingConfirmation)
+	}
+	for t, pc := range c.pending {
+		if now.After(pc.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = pendingConfirmation{key: key, expires: now.Add(confirmTimeout)}
+	return token, nil
+}
+
+// take reports whether the token confirms the request with the given key, and uses it up.
+func (c *confirmations) take(token, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc, ok := c.pending[token]
+	if !ok || pc.key != key {
+		return false
+	}
+	delete(c.pending, token)
+	return time.Now().Before(pc.expires)
+}
+
+// newBulkRequest checks the parameters of a bulk action. clear_network deletes every
+// paste, delete_many the listed ones and delete_before those created before the given
+// RFC 3339 time. Pinned pastes are only deleted when listed.
+func newBulkRequest(action, network string, ids []int64, before string) (bulkRequest, error) {
+	req := bulkRequest{action: action, network: network}
+	switch action {
+	case "clear_network":
+		req.sel.KeepPinned = true
+	case "delete_many":
+		if len(ids) == 0 || len(ids) > maxBulkIds {
+			return req, fmt.Errorf("delete_many needs between 1 and %d ids", maxBulkIds)
+		}
+		req.sel.Ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	case "delete_before":
+		t, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return req, errors.New("delete_before needs a time like 2006-01-02T15:04:05Z")
+		}
+		req.sel.Before = t
+		req.sel.KeepPinned = true
+	default:
+		return req, fmt.Errorf("unknown bulk action %q", action)
+	}
+	return req, nil
+}
+
+// bulkDelete deletes the pastes selected by the request on behalf of a device, moving
+// them to the trash if there is one. Unless confirm is a token issued for the same
+// request, nothing is deleted and errConfirmRequired is returned with the number of
+// pastes that would be deleted and a token to confirm. Deletions are told to the network
+// in a single event followed by the new paste list.
+func (p *ptServer) bulkDelete(req bulkRequest, user, author, confirm string) (bulkResult, error) {
+	if p.deletePolicy == deleteAuthor {
+		req.sel.Author = author
+	}
+
+	if confirm == "" || !p.confirms.take(confirm, req.key()) {
+		count, err := p.dbm.CountPastes(req.network, req.sel)
+		if err != nil {
+			return bulkResult{}, err
+		}
+		token, err := p.confirms.issue(req.key())
+		if err != nil {
+			return bulkResult{}, err
+		}
+		return bulkResult{Count: count, Confirm: token}, errConfirmRequired
+	}
+
+	ids, err := p.dbm.DeletePastes(req.network, req.sel, user, time.Now(), p.trashWindow > 0)
+	if err != nil {
+		return bulkResult{}, err
+	}
+	if len(ids) > 0 {
+		p.publishEvent(req.network, serverEvent{Event: "delete_many", Ids: ids, Count: len(ids), By: user}, nil)
+		p.publishPastes(req.network)
+	}
+	return bulkResult{Count: len(ids), Ids: ids}, nil
+}
+
+// bulkDeleteClient runs a bulk action sent by a client. The client is asked to confirm
+// with a confirm event before anything is deleted.
+func (p *ptServer) bulkDeleteClient(c *client, msg clientMessage) {
+	req, err := newBulkRequest(msg.Action, c.network, msg.Ids, msg.Before)
+	if err != nil {
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+		return
+	}
+
+	res, err := p.bulkDelete(req, p.clientName(c), c.author, msg.Confirm)
+	if errors.Is(err, errConfirmRequired) {
+		c.sendEvent(serverEvent{
+			Event:   "confirm",
+			Message: fmt.Sprintf("%s deletes %d pastes, send it again with confirm to proceed", msg.Action, res.Count),
+			Count:   res.Count,
+			Confirm: res.Confirm,
+		})
+		return
+	}
+	if err != nil {
+		p.logError("error deleting pastes: %v\n", err)
+		c.sendEvent(serverEvent{Event: "error", Message: "could not delete pastes"})
+	}
+}
+
+// bulkDeleteHandler deletes pastes of the caller's network: those listed in id query
+// parameters, those created before the before parameter, or all of them. The first call
+// answers 409 Conflict with the number of pastes and a token, and the deletion happens
+// when it is repeated with the token in the confirm parameter. The optional user
+// parameter names the deleting device in delete events. The API cannot tell which device
+// is calling, so it is refused under the author policy.
+func (p *ptServer) bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if p.deletePolicy == deleteAuthor {
+		http.Error(w, "Bulk deletion over the API is not available when only authors can delete pastes", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+
+	action := "clear_network"
+	var ids []int64
+	switch {
+	case q.Has("id"):
+		action = "delete_many"
+		for _, s := range q["id"] {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+	case q.Has("before"):
+		action = "delete_before"
+	}
+
+	req, err := newBulkRequest(action, p.getRequestIP(r), ids, q.Get("before"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := p.validateName(q.Get("user"))
+	if err != nil {
+		user = "anonymous"
+	}
+
+	res, err := p.bulkDelete(req, user, "", q.Get("confirm"))
+	if errors.Is(err, errConfirmRequired) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestBulkDeleteActions(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	other := dialEvents(t, ctx, s.URL, "CALM-HERON")
+	defer other.CloseNow()
+	readPastes(t, ctx, other)
+
+	old, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "old", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "new", CreatedAt: time.Now()})
+	pinned, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "pinned", CreatedAt: time.Now()})
+	pts.dbm.PinPaste(pinned, "127.0.0.1", true)
+
+	before := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "delete_before", "before": before}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, c, "confirm")
+	if ev["count"] != float64(1) || ev["confirm"] == nil {
+		t.Fatalf("Expected confirmation for 1 paste, got %v", ev)
+	}
+
+	// A token only confirms the request it was issued for
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "clear_network", "confirm": ev["confirm"]}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, c, "confirm")
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "delete_before", "before": before, "confirm": ev["confirm"]}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev = readEvent(t, ctx, other, "delete_many")
+	if ev["by"] != "BRAVE-OTTER" || fmt.Sprint(ev["ids"]) != fmt.Sprintf("[%d]", old) {
+		t.Errorf("Expected one delete_many event for the old paste, got %v", ev)
+	}
+	if pastes, _ := pts.dbm.GetPastes("127.0.0.1"); len(pastes) != 2 {
+		t.Errorf("Expected 2 pastes left, got %v", pastes)
+	}
+
+	// Clearing the network keeps pinned pastes
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "clear_network"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev = readEvent(t, ctx, c, "confirm")
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "clear_network", "confirm": ev["confirm"]}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, c, "delete_many")
+	if pastes, _ := pts.dbm.GetPastes("127.0.0.1"); len(pastes) != 1 || pastes[0].Id != pinned {
+		t.Errorf("Expected only the pinned paste to be kept, got %v", pastes)
+	}
+
+	for _, msg := range []map[string]any{
+		{"action": "delete_many"},
+		{"action": "delete_before", "before": "yesterday"},
+	} {
+		if err := wsjson.Write(ctx, c, msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		readEvent(t, ctx, c, "error")
+	}
+}
+
+func TestBulkDeleteEndpoint(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	first, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "first", CreatedAt: time.Now()})
+	second, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "second", CreatedAt: time.Now()})
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "not yours", CreatedAt: time.Now()})
+
+	path := fmt.Sprintf("/api/pastes?id=%d&id=%d", first, other)
+	w := authRequest(server.Handler, http.MethodDelete, path, "", nil)
+	var res bulkResult
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusConflict || res.Count != 1 || res.Confirm == "" {
+		t.Fatalf("Expected a confirmation for 1 paste, got %v %+v", w.Code, res)
+	}
+
+	// Tokens are single use
+	confirmed := path + "&confirm=" + url.QueryEscape(res.Confirm)
+	w = authRequest(server.Handler, http.MethodDelete, confirmed, "", nil)
+	res = bulkResult{}
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res.Count != 1 || res.Ids[0] != first {
+		t.Errorf("Expected the paste of the network to be deleted, got %v %+v", w.Code, res)
+	}
+	if w := authRequest(server.Handler, http.MethodDelete, confirmed, "", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected a used token to be refused, got %v", w.Code)
+	}
+
+	if pastes, _ := pts.dbm.GetPastes("192.0.2.1"); len(pastes) != 1 || pastes[0].Id != second {
+		t.Errorf("Expected the second paste to be kept, got %v", pastes)
+	}
+	if pastes, _ := pts.dbm.GetPastes("198.51.100.1"); len(pastes) != 1 || pastes[0].Id != other {
+		t.Errorf("Expected the other network to be untouched, got %v", pastes)
+	}
+
+	for _, path := range []string{"/api/pastes?id=abc", "/api/pastes?before=yesterday"} {
+		if w := authRequest(server.Handler, http.MethodDelete, path, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("DELETE %v returned %v, expected %v", path, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestBulkDeleteAuthorPolicy(t *testing.T) {
+	t.Setenv("DELETE_POLICY", "author")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "BRAVE-OTTER", Device: "-", Content: "mine", CreatedAt: time.Now()})
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "CALM-HERON", Device: "-", Content: "theirs", CreatedAt: time.Now()})
+
+	// The user parameter is chosen by the caller, so it cannot prove who pasted what
+	w := authRequest(server.Handler, http.MethodDelete, "/api/pastes?user=BRAVE-OTTER", "", nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected bulk deletion over the API to be refused, got %v", w.Code)
+	}
+	if pastes, _ := pts.dbm.GetPastes("192.0.2.1"); len(pastes) != 2 {
+		t.Errorf("Expected no paste to be deleted, got %v", pastes)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// changeCollection creates, renames or deletes a collection of the client's network for
+// the create_collection, rename_collection and delete_collection actions, and sends the
+// collections to the network. It reports whether pastes changed, which only happens when
+// a collection is deleted, otherwise the client may have been sent an error.
+func (p *ptServer) changeCollection(c *client, msg clientMessage) bool {
+	var err error
+	switch msg.Action {
+	case "create_collection":
+		_, err = p.dbm.CreateCollection(c.network, msg.Text)
+	case "rename_collection":
+		err = p.dbm.RenameCollection(int64(msg.Id), c.network, msg.Text)
+	case "delete_collection":
+		err = p.dbm.DeleteCollection(int64(msg.Id), c.network)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "collection not found"})
+		return false
+	case errors.Is(err, data.ErrInvalidCollectionName), errors.Is(err, data.ErrCollectionExists):
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+		return false
+	default:
+		p.logError("error saving collection: %v\n", err)
+		return false
+	}
+
+	p.publishCollections(c.network)
+	return msg.Action == "delete_collection"
+}
+
+// movePaste moves a paste of the client's network into a collection, or out of its
+// collection when collectionID is 0. It reports whether the paste changed, otherwise
+// the client was sent an error.
+func (p *ptServer) movePaste(c *client, id, collectionID int64) bool {
+	err := p.dbm.MovePaste(id, c.network, collectionID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "paste or collection not found"})
+	default:
+		p.logError("error moving paste: %v\n", err)
+	}
+	return false
+}
+
+// sendCollections sends the collections of its network to a client that just joined,
+// unless the network has none.
+func (p *ptServer) sendCollections(c *client) {
+	collections, err := p.dbm.Collections(c.network)
+	if err != nil {
+		p.logError("error fetching collections: %v\n", err)
+		return
+	}
+	if len(collections) == 0 {
+		return
+	}
+	c.sendEvent(serverEvent{Event: "collections", Collections: collections})
+}
+
+// publishCollections sends the collections of the network to all its clients.
+func (p *ptServer) publishCollections(network string) {
+	collections, err := p.dbm.Collections(network)
+	if err != nil {
+		p.logError("error fetching collections: %v\n", err)
+		return
+	}
+	p.publishEvent(network, serverEvent{Event: "collections", Collections: collections}, nil)
+}
+
+// collectionsHandler returns the collections of the caller's network with the number of
+// pastes in each, sorted by name.
+func (p *ptServer) collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	collections, err := p.dbm.Collections(p.getRequestIP(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if collections == nil {
+		collections = []data.Collection{}
+	}
+	writeJSON(w, collections)
+}
+
+// collectionHandler returns the text pastes of a collection of the caller's network as a
+// single plain text document, oldest first.
+func (p *ptServer) collectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = p.dbm.WriteCollection(&buf, id, p.getRequestIP(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestCollectionActions(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "replicas: 3", CreatedAt: time.Now()})
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "create_collection", "text": "deploy"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, c, "collections")
+	collections := ev["collections"].([]any)
+	if len(collections) != 1 || collections[0].(map[string]any)["Name"] != "deploy" {
+		t.Fatalf("Expected the new collection, got %v", ev)
+	}
+	collection := int64(collections[0].(map[string]any)["Id"].(float64))
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "move", "id": id, "collection_id": collection}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if pastes := readPastes(t, ctx, c); len(pastes) != 1 || pastes[0].CollectionId != collection {
+		t.Errorf("Expected the paste to be moved into the collection, got %v", pastes)
+	}
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "rename_collection", "id": collection, "text": "release"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev = readEvent(t, ctx, c, "collections")
+	if fmt.Sprint(ev["collections"].([]any)[0].(map[string]any)["Name"]) != "release" {
+		t.Errorf("Expected the collection to be renamed, got %v", ev)
+	}
+
+	// Clients joining later are sent the collections after the paste list
+	late := dialEvents(t, ctx, s.URL, "CALM-FOX")
+	defer late.CloseNow()
+	readPastes(t, ctx, late)
+	readEvent(t, ctx, late, "collections")
+
+	for _, msg := range []map[string]any{
+		{"action": "create_collection", "text": "release"},
+		{"action": "create_collection", "text": " "},
+		{"action": "rename_collection", "id": collection + 1, "text": "other"},
+		{"action": "move", "id": id, "collection_id": collection + 1},
+	} {
+		if err := wsjson.Write(ctx, c, msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		readEvent(t, ctx, c, "error")
+	}
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "delete_collection", "id": collection}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if ev := readEvent(t, ctx, c, "collections"); ev["collections"] != nil {
+		t.Errorf("Expected no collections left, got %v", ev)
+	}
+	if pastes := readPastes(t, ctx, c); len(pastes) != 1 || pastes[0].CollectionId != 0 {
+		t.Errorf("Expected the paste to be kept outside of the deleted collection, got %v", pastes)
+	}
+}
+
+func TestCollectionEndpoints(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	deploy, _ := pts.dbm.CreateCollection("192.0.2.1", "deploy")
+	pts.dbm.CreateCollection("192.0.2.1", "notes")
+	other, _ := pts.dbm.CreateCollection("198.51.100.1", "deploy")
+	created := time.Now().Add(-time.Hour)
+	for i, content := range []string{"[app]\nport = 8080", "[db]\nhost = localhost\n"} {
+		id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: content, CreatedAt: created.Add(time.Duration(i) * time.Minute)})
+		pts.dbm.MovePaste(id, "192.0.2.1", deploy.Id)
+	}
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "loose", CreatedAt: time.Now()})
+
+	w := authRequest(server.Handler, http.MethodGet, "/api/collections", "", nil)
+	var collections []data.Collection
+	json.NewDecoder(w.Body).Decode(&collections)
+	if len(collections) != 2 || collections[0].Name != "deploy" || collections[0].Count != 2 {
+		t.Errorf("Expected the collections of the network, got %v", collections)
+	}
+
+	w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/collections/%d", deploy.Id), "", nil)
+	if want := "[app]\nport = 8080\n\n[db]\nhost = localhost\n"; w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("Expected the collection as one document, got %v %q", w.Code, w.Body.String())
+	}
+	if w := authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/collections/%d", other.Id), "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected collection of another network not to be found, got %v", w.Code)
+	}
+
+	w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/pastes?collection=%d", deploy.Id), "", nil)
+	var pastes []data.Paste
+	json.NewDecoder(w.Body).Decode(&pastes)
+	if len(pastes) != 2 {
+		t.Errorf("Expected the pastes of the collection, got %v", pastes)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// deviceCookie is the name of the cookie holding the signed ID of a device. Pastes
+// remember the ID of the device that pasted them, which the author delete and edit
+// policies check.
+const deviceCookie = "pt_device"
+
+// deviceLifetime is how long a device keeps its ID without connecting again.
+const deviceLifetime = time.Hour * 24 * 365
+
+// issueDevice returns the device ID of the request, and issues a new one in a signed
+// cookie if the request has none. Device names and user agents are chosen by the
+// devices, the ID is not.
+func (p *ptServer) issueDevice(w http.ResponseWriter, r *http.Request) (string, error) {
+	id, ok := p.deviceID(r)
+	if !ok {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		id = hex.EncodeToString(b)
+	}
+
+	// The cookie is issued again so devices in use keep their ID
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookie,
+		Value:    p.access.signDevice(id),
+		Path:     "/",
+		Expires:  time.Now().Add(deviceLifetime),
+		HttpOnly: true,
+		Secure:   p.secureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return id, nil
+}
+
+// deviceID returns the device ID of the request's cookie if its signature is valid.
+func (p *ptServer) deviceID(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(deviceCookie)
+	if err != nil {
+		return "", false
+	}
+	return p.access.verifyDevice(cookie.Value)
+}
+
+// signDevice creates a device token for the ID, signed with the session key.
+func (ac *accessControl) signDevice(id string) string {
+	return id + "." + base64.RawURLEncoding.EncodeToString(ac.mac("device|"+id))
+}
+
+// verifyDevice checks the device token and returns its ID.
+func (ac *accessControl) verifyDevice(token string) (string, bool) {
+	id, encSig, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, ac.mac("device|"+id)) {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// dialDevice opens a websocket that accepts event frames with the given cookie, which may
+// be nil, and returns the device cookie the server issued.
+func dialDevice(t *testing.T, ctx context.Context, url, name string, cookie *http.Cookie) (*websocket.Conn, *http.Cookie) {
+	t.Helper()
+
+	header := http.Header{}
+	if cookie != nil {
+		header.Set("Cookie", cookie.String())
+	}
+	c, resp, err := websocket.Dial(ctx, url+"/ws?events=1&name="+name, &websocket.DialOptions{
+		Subprotocols: []string{subprotocol}, HTTPHeader: header})
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	for _, issued := range resp.Cookies() {
+		if issued.Name == deviceCookie {
+			return c, issued
+		}
+	}
+	t.Fatalf("Expected a device cookie, got %v", resp.Header)
+	return nil, nil
+}
+
+func TestDeviceCookie(t *testing.T) {
+	t.Setenv("DELETE_POLICY", "author")
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	author, cookie := dialDevice(t, ctx, s.URL, "BRAVE-OTTER", nil)
+	readPastes(t, ctx, author)
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "add", "text": "mine"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, author)
+	author.CloseNow()
+
+	// The same name and browser do not make the same device
+	impostor, issued := dialDevice(t, ctx, s.URL, "BRAVE-OTTER", nil)
+	defer impostor.CloseNow()
+	readPastes(t, ctx, impostor)
+	if issued.Value == cookie.Value {
+		t.Errorf("Expected another device to get another ID")
+	}
+	if err := wsjson.Write(ctx, impostor, map[string]any{"action": "delete", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, impostor, "error")
+
+	// Nor does a device ID without a valid signature
+	id, _, _ := strings.Cut(cookie.Value, ".")
+	forger, _ := dialDevice(t, ctx, s.URL, "BRAVE-OTTER", &http.Cookie{Name: deviceCookie, Value: id + ".Zm9yZ2Vk"})
+	defer forger.CloseNow()
+	readPastes(t, ctx, forger)
+	if err := wsjson.Write(ctx, forger, map[string]any{"action": "delete", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, forger, "error")
+
+	// The device keeps its ID when it connects again, whatever it is called
+	author, renewed := dialDevice(t, ctx, s.URL, "CALM-HERON", cookie)
+	defer author.CloseNow()
+	readPastes(t, ctx, author)
+	if renewed.Value != cookie.Value || !renewed.HttpOnly || renewed.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Expected the device cookie to be renewed, got %v", renewed)
+	}
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "delete", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, author, "delete")
+}
+
+func TestDeviceCookieFromIdentity(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	w := authRequest(server.Handler, http.MethodGet, "/id", "", nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != deviceCookie {
+		t.Fatalf("Expected the identity to issue a device cookie, got %v", cookies)
+	}
+
+	pts := server.Handler.(*ptServer)
+	if _, ok := pts.access.verifyDevice(cookies[0].Value); !ok {
+		t.Errorf("Expected the device cookie to be signed")
+	}
+	_, sig, _ := strings.Cut(cookies[0].Value, ".")
+	if _, ok := pts.access.verifyDevice("0123456789abcdef." + sig); ok {
+		t.Errorf("Expected a device token with another ID to be refused")
+	}
+}
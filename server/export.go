@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/media"
+)
+
+// maxImportSize is the largest export accepted by the import endpoint.
+const maxImportSize = 64 << 20
+
+// exportTypes are the content types and file extensions of the export formats.
+var exportTypes = map[string]struct{ mime, ext string }{
+	data.FormatJSON:     {"application/json", "json"},
+	data.FormatNDJSON:   {"application/x-ndjson", "ndjson"},
+	data.FormatMarkdown: {"text/markdown; charset=utf-8", "md"},
+	data.FormatZip:      {"application/zip", "zip"},
+}
+
+// exportHandler downloads the pastes of the caller's network in the format given by the
+// format query parameter, JSON by default.
+func (p *ptServer) exportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = data.FormatJSON
+	}
+	if !slices.Contains(data.Formats, format) {
+		http.Error(w, data.ErrUnknownFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The export is built first so that errors can still be reported
+	var buf bytes.Buffer
+	if err := p.dbm.Export(&buf, p.getRequestIP(r), format); err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	t := exportTypes[format]
+	w.Header().Set("Content-Type", t.mime)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="pastytext-export.%s"`, t.ext))
+	w.Write(buf.Bytes())
+}
+
+// checkImportedFile applies the checks of uploads to the file of an imported attachment.
+// Images are also encoded again, like clipboard images, to strip their metadata.
+func (p *ptServer) checkImportedFile(name string, file []byte) (string, []byte, error) {
+	if int64(len(file)) > p.maxAttachment {
+		return "", nil, errAttachmentTooLarge
+	}
+	if media.ClipboardTypes[http.DetectContentType(file)] {
+		normalized, _, err := media.Normalize(file)
+		if err != nil {
+			return "", nil, errInvalidImage
+		}
+		file = normalized
+	}
+	return attachmentName(name), file, nil
+}
+
+// importHandler adds the pastes of an export in the request body to the caller's network.
+// The format query parameter names the format, which is guessed when it is not given.
+func (p *ptServer) importHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Export is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = data.DetectFormat(b)
+	}
+	if !slices.Contains(data.Formats, format) {
+		http.Error(w, data.ErrUnknownFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	network := p.getRequestIP(r)
+	n, err := p.dbm.Import(b, network, format, p.checkImportedFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.publishPastes(network)
+	p.publishCollections(network)
+	writeJSON(w, struct {
+		Imported int `json:"imported"`
+	}{n})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestExportImportEndpoints(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "alice", Device: "laptop", Content: "first"})
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "bob", Device: "phone", Content: "second"})
+	pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "other network"})
+
+	w := authRequest(server.Handler, http.MethodGet, "/api/export?format=markdown", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/export returned %v %v", w.Code, w.Body)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "pastytext-export.md") {
+		t.Errorf("Expected a markdown file name, got %q", cd)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "second") || strings.Contains(body, "other network") {
+		t.Errorf("Expected only pastes of the network to be exported, got %q", body)
+	}
+
+	if w := authRequest(server.Handler, http.MethodGet, "/api/export?format=csv", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown format to be rejected, got %v", w.Code)
+	}
+
+	// The default JSON export is imported back without a format
+	export := authRequest(server.Handler, http.MethodGet, "/api/export", "", nil).Body.String()
+	w = authRequest(server.Handler, http.MethodPost, "/api/import", export, nil)
+	var res struct {
+		Imported int `json:"imported"`
+	}
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res.Imported != 2 {
+		t.Fatalf("POST /api/import returned %v, imported %v, expected 2", w.Code, res.Imported)
+	}
+
+	pastes, _ := pts.dbm.GetPastes("192.0.2.1")
+	if len(pastes) != 4 {
+		t.Errorf("Expected 4 pastes after import, got %v", len(pastes))
+	}
+
+	if w := authRequest(server.Handler, http.MethodPost, "/api/import?format=json", "not json", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid export to be rejected, got %v", w.Code)
+	}
+}
+
+func TestImportChecksAttachments(t *testing.T) {
+	t.Setenv("ATTACHMENT_MAX_SIZE", "4096")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	var img bytes.Buffer
+	jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 20, 10)), nil)
+	exif := []byte("Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x00GPS 52.37N 4.89E")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, img.Bytes()[2:]...)
+
+	long := strings.Repeat("a", 300) + ".jpg"
+	records := []data.Record{
+		{User: "alice", Attachment: &data.RecordFile{Name: long, Path: "files/1"}},
+		{User: "alice", Attachment: &data.RecordFile{Name: "big.bin", Path: "files/2"}},
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for path, file := range map[string][]byte{"files/1": photo, "files/2": make([]byte, 8192)} {
+		fw, _ := zw.Create(path)
+		fw.Write(file)
+	}
+	fw, _ := zw.Create("pastes.json")
+	json.NewEncoder(fw).Encode(records)
+	zw.Close()
+
+	w := authRequest(server.Handler, http.MethodPost, "/api/import", buf.String(), nil)
+	var res struct {
+		Imported int `json:"imported"`
+	}
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res.Imported != 1 {
+		t.Fatalf("Expected only the photo to be imported, got %v %v", w.Code, res.Imported)
+	}
+
+	pastes, _ := pts.dbm.GetPastes("192.0.2.1")
+	if len(pastes) != 1 || pastes[0].Attachment == nil {
+		t.Fatalf("Expected an imported attachment, got %+v", pastes)
+	}
+	a := pastes[0].Attachment
+	if len(a.Name) != maxAttachmentName || a.Mime != "image/jpeg" {
+		t.Errorf("Expected a truncated name and a jpeg, got %+v", a)
+	}
+	_, file, _ := pts.dbm.GetAttachment(a.Id, "192.0.2.1")
+	if bytes.Contains(file, []byte("GPS")) || bytes.Contains(file, []byte("Exif")) {
+		t.Errorf("Expected EXIF to be stripped")
+	}
+}
+
+func TestCrossOriginImport(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	w := crossSiteRequest(server.Handler, http.MethodPost, "/api/import", "text/plain", `[{"content":"planted"}]`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a cross-origin import to be refused, got %v", w.Code)
+	}
+	if pastes, _ := pts.dbm.GetPastes("192.0.2.1"); len(pastes) != 0 {
+		t.Errorf("Expected nothing to be imported, got %v", pastes)
+	}
+}
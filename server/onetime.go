@@ -0,0 +1,62 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// oneTimeContent replaces the content of unconsumed one-time pastes in paste lists.
+const oneTimeContent = "One-time paste, it is deleted once read"
+
+// consume deletes the one-time paste of the network, returns it and publishes the
+// paste list without it. Only one caller ever gets the content.
+func (p *ptServer) consume(id int64, network string) (data.Paste, error) {
+	paste, err := p.dbm.ConsumePaste(id, network)
+	if err != nil {
+		return paste, err
+	}
+	p.publishPastes(network)
+	return paste, nil
+}
+
+// consumePaste sends the content of a one-time paste to the client that consumed it. The
+// consume event is the answer to the client's own action, so it is sent even to clients
+// that did not ask for events, otherwise they would burn the paste without reading it.
+func (p *ptServer) consumePaste(c *client, id int64) {
+	paste, err := p.consume(id, c.network)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			p.logError("error consuming paste: %v\n", err)
+		}
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found or already consumed"})
+		return
+	}
+	if err := c.send(serverEvent{Event: "consume", Paste: &paste}); err != nil {
+		p.logError("error sending consumed paste: %v\n", err)
+	}
+}
+
+// consumeHandler returns a one-time paste of the caller's network as JSON and deletes it.
+func (p *ptServer) consumeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	paste, err := p.consume(id, p.getRequestIP(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, paste)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestOneTimePaste(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	host := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer host.CloseNow()
+	readPastes(t, ctx, host)
+
+	guest := dialEvents(t, ctx, s.URL, "CALM-HERON")
+	defer guest.CloseNow()
+	readPastes(t, ctx, guest)
+
+	if err := wsjson.Write(ctx, host, map[string]any{"action": "add", "text": "wifi password", "one_time": true}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readPastes(t, ctx, host)
+	pastes := readPastes(t, ctx, guest)
+	if len(pastes) != 1 || !pastes[0].OneTime || pastes[0].Content != oneTimeContent {
+		t.Fatalf("Expected a one-time placeholder, got %v", pastes)
+	}
+
+	if err := wsjson.Write(ctx, guest, map[string]any{"action": "consume", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, guest, "consume")
+	if paste, _ := ev["paste"].(map[string]interface{}); paste == nil || paste["Content"] != "wifi password" {
+		t.Errorf("Expected consumed paste, got %v", ev)
+	}
+	if pastes := readPastes(t, ctx, host); len(pastes) != 0 {
+		t.Errorf("Expected deletion to be broadcast, got %v", pastes)
+	}
+
+	if err := wsjson.Write(ctx, host, map[string]any{"action": "consume", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, host, "error")
+}
+
+func TestConsumeWithoutEvents(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "wifi password", OneTime: true, CreatedAt: time.Now()})
+
+	c, _, err := websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{Subprotocols: []string{subprotocol}})
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	// Clients that only expect paste lists still get the paste they consumed
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "consume", "id": id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, c, "consume")
+	if paste, _ := ev["paste"].(map[string]interface{}); paste == nil || paste["Content"] != "wifi password" {
+		t.Errorf("Expected consumed paste, got %v", ev)
+	}
+}
+
+func TestConsumeEndpoint(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "wifi password", OneTime: true, CreatedAt: time.Now()})
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "not yours", OneTime: true, CreatedAt: time.Now()})
+
+	path := fmt.Sprintf("/api/pastes/%d/consume", other)
+	if w := authRequest(server.Handler, http.MethodPost, path, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected paste of another network to be refused, got %v", w.Code)
+	}
+
+	path = fmt.Sprintf("/api/pastes/%d/consume", id)
+	w := authRequest(server.Handler, http.MethodPost, path, "", nil)
+	var paste data.Paste
+	json.NewDecoder(w.Body).Decode(&paste)
+	if w.Code != http.StatusOK || paste.Content != "wifi password" {
+		t.Errorf("Expected one-time paste, got %v %v", w.Code, paste)
+	}
+
+	if w := authRequest(server.Handler, http.MethodPost, path, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected second consume to fail, got %v", w.Code)
+	}
+}
+
+func TestCrossOriginConsume(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "wifi password", OneTime: true, CreatedAt: time.Now()})
+
+	w := crossSiteRequest(server.Handler, http.MethodPost, fmt.Sprintf("/api/pastes/%d/consume", id), "text/plain", "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a cross-origin consume to be refused, got %v", w.Code)
+	}
+	if pastes, _ := pts.dbm.GetPastes("192.0.2.1"); len(pastes) != 1 {
+		t.Errorf("Expected the one-time paste to be kept, got %v", pastes)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// crossOrigin reports whether a request that changes state was sent by a page of another
+// origin, which would let any website act on the network of its visitors. Browsers tell
+// the origin in Sec-Fetch-Site or Origin, and requests without either do not come from a
+// page. Origins allowed to open a websocket, through ALLOWED_ORIGINS or
+// INSECURE_SKIP_ORIGIN_CHECK, are allowed here too.
+func (p *ptServer) crossOrigin(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if p.accept.InsecureSkipVerify {
+		return false
+	}
+
+	site := r.Header.Get("Sec-Fetch-Site")
+	if site == "same-origin" || site == "none" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return site != ""
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(u.Host)
+	if host == strings.ToLower(r.Host) {
+		return false
+	}
+	for _, pattern := range p.accept.OriginPatterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), host); ok {
+			return false
+		}
+	}
+	return true
+}
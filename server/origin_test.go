@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// crossSiteRequest sends the request a page of another site would send with a form or fetch.
+func crossSiteRequest(handler http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestCrossOriginClaim(t *testing.T) {
+	t.Setenv("ACCESS_CONTROL", "true")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	w := crossSiteRequest(server.Handler, http.MethodPost, "/auth/claim", "text/plain", `{"passphrase":"correct horse"}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a cross-origin claim to be refused, got %v", w.Code)
+	}
+	if since, _ := pts.dbm.ProtectedSince("192.0.2.1"); !since.IsZero() {
+		t.Errorf("Expected the network not to be claimed by another site")
+	}
+	if w := authRequest(server.Handler, http.MethodGet, "/api/pastes", "", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the network to stay open, got %v", w.Code)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "*.example.org")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	tests := []struct {
+		method string
+		header map[string]string
+		want   bool
+	}{
+		{http.MethodGet, map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, false},
+		{http.MethodPost, nil, false},
+		{http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"}, false},
+		{http.MethodPost, map[string]string{"Sec-Fetch-Site": "none"}, false},
+		{http.MethodPost, map[string]string{"Origin": "http://example.com"}, false},
+		{http.MethodPost, map[string]string{"Origin": "https://app.example.org", "Sec-Fetch-Site": "cross-site"}, false},
+		{http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-site"}, true},
+		{http.MethodPost, map[string]string{"Origin": "https://evil.example"}, true},
+		{http.MethodDelete, map[string]string{"Origin": "null"}, true},
+		{http.MethodPut, map[string]string{"Origin": "http://example.com.evil.example"}, true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/settings", nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		if got := pts.crossOrigin(req); got != tt.want {
+			t.Errorf("crossOrigin(%v %v) = %v, expected %v", tt.method, tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// pinPaste pins or unpins a paste of the client's network. It reports whether the paste
+// changed, otherwise the client was sent an error.
+func (p *ptServer) pinPaste(c *client, id int64, pinned bool) bool {
+	err := p.dbm.PinPaste(id, c.network, pinned)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+	case errors.Is(err, data.ErrTooManyPins):
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+	default:
+		p.logError("error pinning paste: %v\n", err)
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestPinPaste(t *testing.T) {
+	t.Setenv("MAX_PINS", "1")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	first, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "office wifi", CreatedAt: time.Now().Add(-time.Hour)})
+	second, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "newer", CreatedAt: time.Now()})
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "not yours", CreatedAt: time.Now()})
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "pin", "id": first}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 2 || pastes[0].Id != first || !pastes[0].Pinned {
+		t.Errorf("Expected pinned paste on top, got %v", pastes)
+	}
+
+	for _, id := range []int64{second, other} {
+		if err := wsjson.Write(ctx, c, map[string]any{"action": "pin", "id": id}); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		readEvent(t, ctx, c, "error")
+	}
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "unpin", "id": first}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes = readPastes(t, ctx, c)
+	if len(pastes) != 2 || pastes[0].Id != second || pastes[1].Pinned {
+		t.Errorf("Expected unpinned paste back in order, got %v", pastes)
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/mileusna/useragent"
+)
+
+// Limits for device names chosen by users.
+const (
+	minNameLength = 2
+	maxNameLength = 32
+)
+
+var (
+	errNameLength  = errors.New("name must be between 2 and 32 characters")
+	errNameChars   = errors.New("name may only contain letters, digits, spaces, dashes and underscores")
+	errNameBlocked = errors.New("name contains a blocked word")
+	errNameTaken   = errors.New("name is already used on this network")
+)
+
+// serverEvent is a message sent to clients for anything other than the paste list.
+// The paste list itself is still sent as a plain JSON array, and events are only sent
+// to clients that asked for them with the events query parameter so that clients
+// expecting nothing but paste lists keep working.
+type serverEvent struct {
+	Event   string          `json:"event"`
+	Client  *presenceEntry  `json:"client,omitempty"`
+	Clients []presenceEntry `json:"clients,omitempty"`
+	OldName string          `json:"old_name,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Paste   *data.Paste     `json:"paste,omitempty"`
+	Pastes  []data.Paste    `json:"pastes,omitempty"`
+	Ids     []int64         `json:"ids,omitempty"`
+	Count   int             `json:"count,omitempty"`
+	Confirm string          `json:"confirm,omitempty"`
+	By      string          `json:"by,omitempty"`
+
+	// Id and Reactions are the paste and its reactions in react events.
+	Id        int64           `json:"id,omitempty"`
+	Reactions []data.Reaction `json:"reactions,omitempty"`
+
+	// Collections are the collections of the network in collections events.
+	Collections []data.Collection `json:"collections,omitempty"`
+
+	// Scheduled are the pastes of the network waiting to be published in scheduled events.
+	Scheduled []data.ScheduledPaste `json:"scheduled,omitempty"`
+}
+
+// presenceEntry describes a connected client in presence events.
+type presenceEntry struct {
+	Name   string `json:"name"`
+	Device string `json:"device"`
+	Type   string `json:"type"`
+}
+
+// deviceType returns a coarse device category for the parsed user agent.
+func deviceType(ua useragent.UserAgent) string {
+	switch {
+	case ua.Tablet:
+		return "tablet"
+	case ua.Mobile:
+		return "mobile"
+	case ua.Desktop:
+		return "desktop"
+	case ua.Bot:
+		return "bot"
+	}
+	return "unknown"
+}
+
+// validateName trims the name and checks it is acceptable as a device name.
+func (p *ptServer) validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if n := len([]rune(name)); n < minNameLength || n > maxNameLength {
+		return "", errNameLength
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != ' ' {
+			return "", errNameChars
+		}
+	}
+	if p.names.IsBlocked(name) {
+		return "", errNameBlocked
+	}
+	return name, nil
+}
+
+// addClient registers the client, settles its name and announces it to the network. It
+// reports false once the server is closing, otherwise Close waits for the client until
+// background.Done is called.
+func (p *ptServer) addClient(c *client) bool {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		p.mu.Unlock()
+		return false
+	default:
+	}
+	p.background.Add(1)
+
+	name, err := p.validateName(c.name)
+	if err != nil || p.nameInUse(c.network, name, c) || !p.names.Reserve(c.network, name) {
+		name = p.names.Generate(c.network)
+	}
+	c.name = name
+	p.clients[c] = struct{}{}
+	self := c.presence()
+	p.mu.Unlock()
+
+	c.sendEvent(serverEvent{Event: "presence", Client: self, Clients: p.presence(c.network)})
+	p.publishEvent(c.network, serverEvent{Event: "join", Client: self}, c)
+	return true
+}
+
+// removeClient unregisters the client and announces its departure. It is safe to call more than once.
+func (p *ptServer) removeClient(c *client) {
+	p.mu.Lock()
+	_, ok := p.clients[c]
+	if ok {
+		delete(p.clients, c)
+		p.names.Release(c.network, c.name)
+	}
+	self := c.presence()
+	p.mu.Unlock()
+
+	if ok {
+		p.publishEvent(c.network, serverEvent{Event: "leave", Client: self}, nil)
+	}
+}
+
+// renameClient changes the name of the client, keeping names unique within the network.
+func (p *ptServer) renameClient(c *client, newName string) error {
+	name, err := p.validateName(newName)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	oldName := c.name
+	if !strings.EqualFold(name, oldName) {
+		if p.nameInUse(c.network, name, c) || !p.names.Reserve(c.network, name) {
+			p.mu.Unlock()
+			return errNameTaken
+		}
+		p.names.Release(c.network, oldName)
+	}
+	c.name = name
+	self := c.presence()
+	p.mu.Unlock()
+
+	p.publishEvent(c.network, serverEvent{Event: "rename", Client: self, OldName: oldName}, nil)
+	return nil
+}
+
+// nameInUse reports whether another connected client on the network uses the name.
+// The caller must hold p.mu.
+func (p *ptServer) nameInUse(network, name string, self *client) bool {
+	for other := range p.clients {
+		if other != self && other.network == network && strings.EqualFold(other.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkClients returns the clients connected from the network.
+func (p *ptServer) networkClients(network string) []*client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var clients []*client
+	for c := range p.clients {
+		if c.network == network {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// presence returns the presence entries of every client connected from the network.
+func (p *ptServer) presence(network string) []presenceEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := []presenceEntry{}
+	for c := range p.clients {
+		if c.network == network {
+			entries = append(entries, *c.presence())
+		}
+	}
+	return entries
+}
+
+// clientName returns the current name of the client.
+func (p *ptServer) clientName(c *client) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return c.name
+}
+
+// publishEvent sends the event to every client on the network except skip.
+func (p *ptServer) publishEvent(network string, event serverEvent, skip *client) {
+	for _, c := range p.networkClients(network) {
+		if c != skip {
+			c.sendEvent(event)
+		}
+	}
+}
+
+// presence describes the client for presence events. The caller must hold p.mu.
+func (c *client) presence() *presenceEntry {
+	return &presenceEntry{Name: c.name, Device: c.device, Type: c.kind}
+}
+
+// sendEvent sends an event to the client if it accepts events.
+func (c *client) sendEvent(event serverEvent) error {
+	if !c.events {
+		return nil
+	}
+	return c.send(event)
+}
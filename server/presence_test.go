@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+func TestPresence(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	first := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer first.CloseNow()
+
+	ev := readEvent(t, ctx, first, "presence")
+	if self := ev["client"].(map[string]interface{}); self["name"] != "BRAVE-OTTER" {
+		t.Errorf("Expected requested name to be kept, got %v", self["name"])
+	}
+
+	// A second device asking for the same name gets a generated one instead
+	second := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer second.CloseNow()
+
+	ev = readEvent(t, ctx, second, "presence")
+	secondName := ev["client"].(map[string]interface{})["name"]
+	if secondName == "BRAVE-OTTER" || secondName == "" {
+		t.Errorf("Expected a unique name for the second device, got %v", secondName)
+	}
+	if clients := ev["clients"].([]interface{}); len(clients) != 2 {
+		t.Errorf("Expected 2 clients in presence list, got %v", len(clients))
+	}
+
+	ev = readEvent(t, ctx, first, "join")
+	if ev["client"].(map[string]interface{})["name"] != secondName {
+		t.Errorf("Expected join event for %v, got %v", secondName, ev["client"])
+	}
+
+	second.Close(websocket.StatusNormalClosure, "closing connection")
+	ev = readEvent(t, ctx, first, "leave")
+	if ev["client"].(map[string]interface{})["name"] != secondName {
+		t.Errorf("Expected leave event for %v, got %v", secondName, ev["client"])
+	}
+}
+
+func TestRename(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	first := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer first.CloseNow()
+	readEvent(t, ctx, first, "presence")
+
+	second := dialEvents(t, ctx, s.URL, "CALM-DOG")
+	defer second.CloseNow()
+	readEvent(t, ctx, second, "presence")
+
+	err := wsjson.Write(ctx, second, map[string]string{"action": "rename", "text": "brave-otter"})
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, second, "error")
+	if ev["message"] != errNameTaken.Error() {
+		t.Errorf("Expected duplicate name to be refused, got %v", ev["message"])
+	}
+
+	err = wsjson.Write(ctx, second, map[string]string{"action": "rename", "text": "<script>"})
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev = readEvent(t, ctx, second, "error")
+	if ev["message"] != errNameChars.Error() {
+		t.Errorf("Expected invalid name to be refused, got %v", ev["message"])
+	}
+
+	err = wsjson.Write(ctx, second, map[string]string{"action": "rename", "text": "Kitchen Laptop"})
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev = readEvent(t, ctx, first, "rename")
+	if ev["old_name"] != "CALM-DOG" || ev["client"].(map[string]interface{})["name"] != "Kitchen Laptop" {
+		t.Errorf("Expected rename from CALM-DOG to Kitchen Laptop, got %v", ev)
+	}
+}
+
+func TestEventOrder(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readEvent(t, ctx, c, "presence")
+
+	for i := range 50 {
+		pts.publishEvent("127.0.0.1", serverEvent{Event: "test", Count: i + 1}, nil)
+	}
+
+	// Events are sent to each client in the order they were published
+	for i := range 50 {
+		if ev := readEvent(t, ctx, c, "test"); ev["count"] != float64(i+1) {
+			t.Fatalf("Expected event %d, got %v", i+1, ev["count"])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// newTrustedProxies parses the comma separated addresses and CIDR ranges of the reverse
+// proxies listed in TRUSTED_PROXIES. Only requests coming from them may tell the address
+// of the client with X-Forwarded-For.
+func newTrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, s := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// trustedProxy reports whether the address is one of the trusted proxies.
+func (p *ptServer) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range p.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether the request was made by a trusted proxy, whose
+// forwarding headers can be believed.
+func (p *ptServer) fromTrustedProxy(r *http.Request) bool {
+	addr, ok := parseAddr(r.RemoteAddr)
+	return ok && p.trustedProxy(addr)
+}
+
+// getRequestIP returns the address of the client that made the request, which is also
+// the network its pastes belong to. X-Forwarded-For is only read when the request comes
+// from a trusted proxy, and then the right-most address that is not a trusted proxy is
+// used, as the addresses left of it were sent by the client and can be anything.
+func (p *ptServer) getRequestIP(r *http.Request) string {
+	addr, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !p.trustedProxy(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(strings.TrimSpace(hops[i]))
+		if !ok {
+			break
+		}
+		if !p.trustedProxy(hop) {
+			return hop.String()
+		}
+		addr = hop
+	}
+	return addr.String()
+}
+
+// parseAddr parses an IPv4 or IPv6 address, with or without a port. IPv4 addresses
+// mapped to IPv6 are returned as IPv4 and zones are dropped.
+func parseAddr(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetRequestIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, 172.16.0.0/12, fd00::/8")
+	proxies, err := newTrustedProxies()
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	p := &ptServer{trustedProxies: proxies}
+
+	tests := []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"[2001:db8::1]:1234", nil, "2001:db8::1"},
+		{"[::ffff:192.0.2.1]:1234", nil, "192.0.2.1"},
+		{"[fe80::1%eth0]:1234", nil, "fe80::1"},
+		// Clients that are not proxies cannot choose their address
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"[2001:db8::1]:1234", []string{"198.51.100.7"}, "2001:db8::1"},
+		// Trusted proxies forward the right-most address that is not a proxy
+		{"10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"10.0.0.1:1234", []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"10.0.0.1:1234", []string{"198.51.100.7, 172.16.4.2"}, "198.51.100.7"},
+		{"10.0.0.1:1234", []string{"198.51.100.7", "172.16.4.2"}, "198.51.100.7"},
+		{"[fd00::2]:1234", []string{"2001:db8::5"}, "2001:db8::5"},
+		{"10.0.0.1:1234", []string{"[2001:db8::5]:4321"}, "2001:db8::5"},
+		// Without a usable forwarded address the last proxy is used
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"garbage, 172.16.4.2"}, "172.16.4.2"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/id", nil)
+		req.RemoteAddr = tt.remote
+		for _, f := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		if got := p.getRequestIP(req); got != tt.want {
+			t.Errorf("Expected %v for %v forwarding %v, got %v", tt.want, tt.remote, tt.forwarded, got)
+		}
+	}
+}
+
+func TestInvalidTrustedProxy(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, proxy.local")
+	if _, err := newTrustedProxies(); err == nil {
+		t.Errorf("Expected an error for a trusted proxy that is not an address")
+	}
+}
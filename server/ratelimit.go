@@ -0,0 +1,154 @@
+package server
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// Defaults for the rate limiter, overridden by RATE_LIMIT, RATE_BURST,
+// AUTO_BAN_TRIPS and AUTO_BAN_DURATION.
+const (
+	defaultRateLimit       = 5.0
+	defaultRateBurst       = 20.0
+	defaultAutoBanTrips    = 5
+	defaultAutoBanDuration = time.Hour
+)
+
+// tripWindow is the period in which repeated trips of the limiter lead to an automatic ban.
+const tripWindow = time.Minute * 10
+
+// bucketIdle is how long an unused bucket is kept before it is forgotten.
+const bucketIdle = time.Minute * 10
+
+// rateLimiter is a token bucket limiter keyed by network address.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	autoBanTrips    int
+	autoBanDuration time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	trips  []time.Time
+}
+
+// newRateLimiter creates a rate limiter configured from the environment. A RATE_LIMIT
+// of 0 disables rate limiting and an AUTO_BAN_TRIPS of 0 disables automatic bans.
+func newRateLimiter() *rateLimiter {
+	rl := &rateLimiter{
+		rate:            envFloat("RATE_LIMIT", defaultRateLimit),
+		burst:           envFloat("RATE_BURST", defaultRateBurst),
+		autoBanTrips:    int(envFloat("AUTO_BAN_TRIPS", defaultAutoBanTrips)),
+		autoBanDuration: defaultAutoBanDuration,
+		buckets:         make(map[string]*bucket),
+	}
+	if d, err := time.ParseDuration(os.Getenv("AUTO_BAN_DURATION")); err == nil && d > 0 {
+		rl.autoBanDuration = d
+	}
+	return rl
+}
+
+// allow takes a token from the bucket of the key. When the bucket is empty it returns
+// false, and ban is true once the key tripped the limiter autoBanTrips times within
+// tripWindow. Trips are counted at most once per second so a single burst counts once.
+func (rl *rateLimiter) allow(key string) (ok bool, ban bool) {
+	if rl.rate <= 0 {
+		return true, false
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.prune(now)
+
+	b, found := rl.buckets[key]
+	if !found {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, false
+	}
+
+	if n := len(b.trips); n == 0 || now.Sub(b.trips[n-1]) >= time.Second {
+		recent := b.trips[:0]
+		for _, t := range b.trips {
+			if now.Sub(t) < tripWindow {
+				recent = append(recent, t)
+			}
+		}
+		b.trips = append(recent, now)
+	}
+
+	if rl.autoBanTrips > 0 && len(b.trips) >= rl.autoBanTrips {
+		b.trips = nil
+		return false, true
+	}
+	return false, false
+}
+
+// prune forgets idle buckets. The caller must hold rl.mu.
+func (rl *rateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < time.Minute {
+		return
+	}
+	rl.lastPrune = now
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > bucketIdle {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// limited reports whether requests to the path count against the rate limit.
+// Static files are not limited, the websocket is limited per message instead.
+func limited(path string) bool {
+	return path == "/id" || path == "/auth" || strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/api/")
+}
+
+// allow applies the rate limit to the network and bans it temporarily when it keeps
+// tripping the limiter.
+func (p *ptServer) allow(network string) bool {
+	ok, ban := p.limiter.allow(network)
+	if ban {
+		cidr, err := normalizeCIDR(network)
+		if err != nil {
+			return ok
+		}
+
+		expires := time.Now().Add(p.limiter.autoBanDuration)
+		_, err = p.ban(data.Ban{CIDR: cidr, Reason: "automatic: rate limit exceeded", CreatedAt: time.Now(), ExpiresAt: &expires})
+		if err != nil {
+			p.logError("error banning %s: %v\n", network, err)
+		} else {
+			log.Printf("banned %s until %v for exceeding the rate limit\n", network, expires)
+		}
+	}
+	return ok
+}
+
+func envFloat(name string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
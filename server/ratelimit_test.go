@@ -0,0 +1,44 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := &rateLimiter{rate: 1, burst: 3, autoBanTrips: 2, buckets: make(map[string]*bucket)}
+
+	for i := range 3 {
+		if ok, _ := rl.allow("10.0.0.1"); !ok {
+			t.Errorf("Expected request %v within the burst to be allowed", i)
+		}
+	}
+
+	if ok, ban := rl.allow("10.0.0.1"); ok || ban {
+		t.Errorf("Expected request over the burst to be refused without a ban, got %v %v", ok, ban)
+	}
+
+	// Trips within the same second only count once
+	if ok, ban := rl.allow("10.0.0.1"); ok || ban {
+		t.Errorf("Expected repeated refusal in the same second not to ban, got %v %v", ok, ban)
+	}
+
+	if ok, _ := rl.allow("10.0.0.2"); !ok {
+		t.Errorf("Expected other keys to have their own bucket")
+	}
+
+	// Pretend the last trip happened a while ago
+	rl.buckets["10.0.0.1"].trips[0] = time.Now().Add(-time.Second * 2)
+	if ok, ban := rl.allow("10.0.0.1"); ok || !ban {
+		t.Errorf("Expected repeated trips to ban, got %v %v", ok, ban)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rl := &rateLimiter{rate: 0, buckets: make(map[string]*bucket)}
+	for range 100 {
+		if ok, _ := rl.allow("10.0.0.1"); !ok {
+			t.Fatalf("Expected disabled limiter to allow everything")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// replyPaste adds the message of the client as a reply to the paste msg.ParentId and
+// sends it to the network as a reply event.
+func (p *ptServer) replyPaste(c *client, msg clientMessage) {
+	reply, err := p.dbm.InsertReply(data.Paste{
+		User:      msg.User,
+		Device:    msg.Device,
+		Author:    msg.Author,
+		Network:   msg.Network,
+		Content:   msg.Text,
+		CreatedAt: time.Now(),
+		ParentId:  msg.ParentId,
+
+		Encryption: msg.Encryption,
+		OneTime:    msg.OneTime,
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+		return
+	case errors.Is(err, data.ErrNotRepliable):
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+		return
+	default:
+		p.logError("error saving reply: %v\n", err)
+		return
+	}
+
+	masked := maskPastes([]data.Paste{reply})[0]
+	p.publishUpdate(c.network, serverEvent{Event: "reply", Paste: &masked})
+}
+
+// reactPaste adds or takes back the client's reaction to a paste of its network and
+// sends the reactions of the paste to the network as a react event.
+func (p *ptServer) reactPaste(c *client, id int64, emoji string) {
+	reactions, err := p.dbm.React(id, c.network, p.clientName(c), emoji)
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+		return
+	case errors.Is(err, data.ErrInvalidEmoji):
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+		return
+	default:
+		p.logError("error saving reaction: %v\n", err)
+		return
+	}
+
+	p.publishUpdate(c.network, serverEvent{Event: "react", Id: id, Reactions: reactions})
+}
+
+// publishUpdate sends an incremental event to the clients of the network that accept
+// events, and the whole paste list to the clients that only expect paste lists.
+func (p *ptServer) publishUpdate(network string, event serverEvent) {
+	var listOnly []*client
+	for _, c := range p.networkClients(network) {
+		if c.events {
+			c.sendEvent(event)
+		} else {
+			listOnly = append(listOnly, c)
+		}
+	}
+	if len(listOnly) == 0 {
+		return
+	}
+
+	pastes, err := p.dbm.GetPastes(network)
+	if err != nil {
+		p.logError("error fetching pastes: %v\n", err)
+		return
+	}
+	for _, c := range listOnly {
+		c.sendMessageToClient(pastes)
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+)
+
+const (
+	// maxSchedulerWait is the longest the scheduler sleeps before looking for scheduled
+	// pastes again, in case they were added behind its back.
+	maxSchedulerWait = time.Minute
+	// maxScheduleAhead is how far in the future a paste can be scheduled.
+	maxScheduleAhead = 366 * 24 * time.Hour
+)
+
+// schedulePaste stores the paste of the client to be published at msg.PublishAt and
+// sends the scheduled pastes to the network. Times in the past are published by the
+// next run of the scheduler.
+func (p *ptServer) schedulePaste(c *client, msg clientMessage) {
+	at, err := time.Parse(time.RFC3339, msg.PublishAt)
+	if err != nil {
+		c.sendEvent(serverEvent{Event: "error", Message: "publish_at needs a time like 2006-01-02T15:04:05Z"})
+		return
+	}
+	now := time.Now()
+	if at.After(now.Add(maxScheduleAhead)) {
+		c.sendEvent(serverEvent{Event: "error", Message: "pastes can be scheduled at most a year ahead"})
+		return
+	}
+
+	paste := data.Paste{
+		User:      msg.User,
+		Device:    msg.Device,
+		Author:    msg.Author,
+		Network:   msg.Network,
+		Content:   msg.Text,
+		CreatedAt: now,
+
+		Encryption: msg.Encryption,
+		OneTime:    msg.OneTime,
+	}
+	if _, err := p.dbm.SchedulePaste(paste, at); err != nil {
+		p.logError("error scheduling paste: %v\n", err)
+		return
+	}
+	p.reschedule()
+	p.publishScheduled(c.network)
+}
+
+// cancelScheduled deletes a scheduled paste of the client's network and sends the
+// scheduled pastes left to the network.
+func (p *ptServer) cancelScheduled(c *client, id int64) {
+	err := p.dbm.CancelScheduled(id, c.network)
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "scheduled paste not found"})
+		return
+	default:
+		p.logError("error cancelling scheduled paste: %v\n", err)
+		return
+	}
+	p.reschedule()
+	p.publishScheduled(c.network)
+}
+
+// maskScheduled returns a copy of the scheduled pastes masked like maskPastes masks pastes.
+func maskScheduled(scheduled []data.ScheduledPaste) []data.ScheduledPaste {
+	masked := make([]data.ScheduledPaste, len(scheduled))
+	for i, s := range scheduled {
+		switch {
+		case s.OneTime:
+			s.Content = oneTimeContent
+		case s.Secret != detect.None:
+			s.Content = maskedContent
+		}
+		masked[i] = s
+	}
+	return masked
+}
+
+// sendScheduled sends the scheduled pastes of its network to the client. Clients that
+// just joined are not sent anything if the network has none.
+func (p *ptServer) sendScheduled(c *client, joined bool) {
+	scheduled, err := p.dbm.ScheduledPastes(c.network)
+	if err != nil {
+		p.logError("error fetching scheduled pastes: %v\n", err)
+		return
+	}
+	if joined && len(scheduled) == 0 {
+		return
+	}
+	c.sendEvent(serverEvent{Event: "scheduled", Scheduled: maskScheduled(scheduled)})
+}
+
+// publishScheduled sends the scheduled pastes of the network to all its clients.
+func (p *ptServer) publishScheduled(network string) {
+	scheduled, err := p.dbm.ScheduledPastes(network)
+	if err != nil {
+		p.logError("error fetching scheduled pastes: %v\n", err)
+		return
+	}
+	p.publishEvent(network, serverEvent{Event: "scheduled", Scheduled: maskScheduled(scheduled)}, nil)
+}
+
+// startScheduler publishes scheduled pastes once they are due. It sleeps until the next
+// one is due or a paste is scheduled, so the database is not polled. Pastes that became
+// due while the server was down are published as soon as it starts.
+func (p *ptServer) startScheduler() {
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+
+		for {
+			wait := maxSchedulerWait
+			next, ok, err := p.dbm.NextScheduled()
+			switch {
+			case err != nil:
+				p.logError("error fetching scheduled pastes: %v\n", err)
+			case ok && !next.After(time.Now()):
+				if p.publishDue() {
+					continue
+				}
+			case ok:
+				wait = min(time.Until(next), maxSchedulerWait)
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-p.done:
+				timer.Stop()
+				return
+			case <-p.rescheduled:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}()
+}
+
+// publishDue publishes the scheduled pastes that are due to their networks. It reports
+// whether it succeeded.
+func (p *ptServer) publishDue() bool {
+	networks, err := p.dbm.PublishScheduled(time.Now())
+	if err != nil {
+		p.logError("error publishing scheduled pastes: %v\n", err)
+		return false
+	}
+	for _, network := range networks {
+		p.publishPastes(network)
+		p.publishScheduled(network)
+	}
+	return true
+}
+
+// reschedule wakes the scheduler up to look for the next scheduled paste again.
+func (p *ptServer) reschedule() {
+	select {
+	case p.rescheduled <- struct{}{}:
+	default:
+	}
+}
+
+// scheduledHandler returns the scheduled pastes of the caller's network, the next due
+// first. Secrets and one-time pastes are masked as they are in paste lists.
+func (p *ptServer) scheduledHandler(w http.ResponseWriter, r *http.Request) {
+	scheduled, err := p.dbm.ScheduledPastes(p.getRequestIP(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, maskScheduled(scheduled))
+}
+
+// cancelScheduledHandler deletes a scheduled paste of the caller's network.
+func (p *ptServer) cancelScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	network := p.getRequestIP(r)
+	err = p.dbm.CancelScheduled(id, network)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	p.reschedule()
+	p.publishScheduled(network)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"os"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+)
+
+// maskedContent replaces the content of pastes with a detected secret in paste lists.
+const maskedContent = "••••••••"
+
+// maxJanitorInterval is the longest time between two checks for expired secrets.
+const maxJanitorInterval = time.Minute
+
+// maskPastes returns a copy of the pastes with the content of one-time pastes replaced by
+// a placeholder and the content of detected secrets masked, replies included. Clients get
+// the content of a single paste with the consume or reveal action.
+func maskPastes(pastes []data.Paste) []data.Paste {
+	masked := make([]data.Paste, len(pastes))
+	for i, paste := range pastes {
+		switch {
+		case paste.OneTime:
+			paste.Content = oneTimeContent
+		case paste.Secret != detect.None:
+			paste.Content = maskedContent
+		}
+		if paste.Replies != nil {
+			paste.Replies = maskPastes(paste.Replies)
+		}
+		masked[i] = paste
+	}
+	return masked
+}
+
+// revealPaste sends the unmasked paste to the client if it belongs to its network.
+func (p *ptServer) revealPaste(c *client, id int64) {
+	paste, err := p.dbm.GetPaste(id)
+	if err != nil || paste.Network != c.network {
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+		return
+	}
+	if paste.OneTime {
+		c.sendEvent(serverEvent{Event: "error", Message: "one-time pastes can only be consumed"})
+		return
+	}
+	c.sendEvent(serverEvent{Event: "reveal", Paste: &paste})
+}
+
+// startSecretJanitor deletes pastes with a detected secret once they are older than
+// SECRET_TTL. Secrets are kept until deleted by hand when it is not set.
+func (p *ptServer) startSecretJanitor() {
+	ttl, err := time.ParseDuration(os.Getenv("SECRET_TTL"))
+	if err != nil || ttl <= 0 {
+		return
+	}
+
+	interval := min(ttl/4, maxJanitorInterval)
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				networks, err := p.dbm.DeleteSecretsBefore(time.Now().Add(-ttl))
+				if err != nil {
+					p.logError("error deleting expired secrets: %v\n", err)
+					continue
+				}
+				for _, network := range networks {
+					p.publishPastes(network)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+)
+
+func TestSecretMasking(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	if err := wsjson.Write(ctx, c, map[string]string{"action": "add", "text": "Tr0ub4dor&3"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 1 || pastes[0].Content != maskedContent || pastes[0].Secret != detect.Password {
+		t.Fatalf("Expected password to be masked, got %v", pastes)
+	}
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "reveal", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, c, "reveal")
+	if paste, _ := ev["paste"].(map[string]interface{}); paste == nil || paste["Content"] != "Tr0ub4dor&3" {
+		t.Errorf("Expected revealed paste, got %v", ev)
+	}
+
+	// Pastes of other networks cannot be revealed
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "Tr0ub4dor&4", CreatedAt: time.Now()})
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "reveal", "id": id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, c, "error")
+}
+
+func TestSecretTTL(t *testing.T) {
+	t.Setenv("SECRET_TTL", "200ms")
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	for _, text := range []string{"hello", "4111 1111 1111 1111"} {
+		if err := wsjson.Write(ctx, c, map[string]string{"action": "add", "text": text}); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		readPastes(t, ctx, c)
+	}
+
+	// The next list is published once the secret expired
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 1 || pastes[0].Content != "hello" {
+		t.Errorf("Expected expired secret to be deleted, got %v", pastes)
+	}
+}
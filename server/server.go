@@ -3,9 +3,14 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +18,7 @@ import (
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/e2e"
 	"github.com/mileusna/useragent"
 )
 
@@ -22,11 +28,47 @@ const subprotocol = "pastytextProtocol"
 // The clientTimeout is the time that the server will wait for a message from the client.
 const clientTimeout = time.Minute * 5
 
+// outboxSize is the number of messages queued for a client before it is considered too
+// slow and disconnected.
+const outboxSize = 64
+
+// errClientGone is returned when sending to a client that disconnected or fell too far behind.
+var errClientGone = errors.New("client is gone")
+
 // ptServer is a struct that implements the http.Handler interface.
 type ptServer struct {
+	mu       sync.Mutex
 	clients  map[*client]struct{}
 	dbm      *data.Manager
+	names    *data.NameGenerator
+	accept   *websocket.AcceptOptions
+	access   *accessControl
+	bans     banList
+	limiter  *rateLimiter
 	serveMux http.ServeMux
+
+	// trustedProxies are the reverse proxies allowed to forward the client address.
+	trustedProxies []netip.Prefix
+
+	adminToken string
+	errors     errorLog
+
+	// done is closed by Close to stop background work. Work that must finish before the
+	// database is closed, client connections included, is tracked by background.
+	done       chan struct{}
+	background sync.WaitGroup
+
+	maxAttachment int64
+	editPolicy    string
+	trashWindow   time.Duration
+
+	deletePolicy string
+	confirms     confirmations
+
+	backups backupSchedule
+
+	// rescheduled wakes the scheduler up when a paste is scheduled or cancelled.
+	rescheduled chan struct{}
 }
 
 type client struct {
@@ -34,6 +76,17 @@ type client struct {
 	conn    *websocket.Conn
 	network string
 	device  string
+	author  string
+	kind    string
+	name    string
+	events  bool
+
+	connected time.Time
+
+	// outbox holds the messages waiting to be written by writeMessages, so the client
+	// receives them in the order they were sent. closed is closed once the client is gone.
+	outbox chan any
+	closed chan struct{}
 }
 
 type clientMessage struct {
@@ -43,6 +96,35 @@ type clientMessage struct {
 	Text    string `json:"text"`
 	Network string `json:"network"`
 	Device  string `json:"device"`
+
+	Encryption string `json:"encryption"`
+	OneTime    bool   `json:"one_time"`
+
+	// Ids, Before and Confirm are the parameters of bulk deletions.
+	Ids     []int64 `json:"ids"`
+	Before  string  `json:"before"`
+	Confirm string  `json:"confirm"`
+
+	// Tags are the manual tags of the tag action.
+	Tags []string `json:"tags"`
+
+	// ParentId makes an added paste a reply to that paste. Emoji is the reaction of
+	// the react action.
+	ParentId int64  `json:"parent_id"`
+	Emoji    string `json:"emoji"`
+
+	// CollectionId is the collection the move action moves a paste into, 0 to take it
+	// out of its collection. Collections are named by Text.
+	CollectionId int64 `json:"collection_id"`
+
+	// PublishAt schedules an added paste to be published at that time, in RFC 3339.
+	PublishAt string `json:"publish_at"`
+
+	// Data is the file of an upload sent in a binary frame.
+	Data []byte `json:"-"`
+
+	// Author is the device ID of the client, set by the server.
+	Author string `json:"-"`
 }
 
 type chanData struct {
@@ -56,28 +138,190 @@ func NewPtServer() (*ptServer, error) {
 		log.Fatalf("Failed to create data manager: %v\n", err)
 		return nil, err
 	}
+	names, err := newNameGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	accept, err := newAcceptOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := newAccessControl()
+	if err != nil {
+		return nil, err
+	}
+
+	editPolicy, err := newEditPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	deletePolicy, err := newDeletePolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := newTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+
 	pt := &ptServer{
 		clients: make(map[*client]struct{}),
 		dbm:     dbm,
+		names:   names,
+		accept:  accept,
+		access:  access,
+		limiter: newRateLimiter(),
+		done:    make(chan struct{}),
+
+		trustedProxies: trustedProxies,
+
+		maxAttachment: newMaxAttachmentSize(),
+		editPolicy:    editPolicy,
+		trashWindow:   newTrashWindow(),
+
+		deletePolicy: deletePolicy,
+
+		backups:     newBackupSchedule(),
+		rescheduled: make(chan struct{}, 1),
+	}
+
+	if err := pt.reloadBans(); err != nil {
+		return nil, err
 	}
 
 	pt.serveMux.Handle("/", http.FileServer(http.Dir("./web")))
 	pt.serveMux.HandleFunc("/id", pt.idHandler)
 	pt.serveMux.HandleFunc("/ws", pt.joinHandler)
+	pt.serveMux.HandleFunc("GET /auth", pt.authHandler)
+	pt.serveMux.HandleFunc("POST /auth", pt.loginHandler)
+	pt.serveMux.HandleFunc("DELETE /auth", pt.logoutHandler)
+	pt.serveMux.HandleFunc("POST /auth/claim", pt.claimHandler)
+	pt.serveMux.HandleFunc("GET /api/pastes", pt.pastesHandler)
+	pt.serveMux.HandleFunc("DELETE /api/pastes", pt.bulkDeleteHandler)
+	pt.serveMux.HandleFunc("POST /api/pastes/{id}/consume", pt.consumeHandler)
+	pt.serveMux.HandleFunc("GET /api/pastes/{id}/versions", pt.versionsHandler)
+	pt.serveMux.HandleFunc("GET /api/pastes/{id}/diff", pt.diffHandler)
+	pt.serveMux.HandleFunc("POST /api/attachments", pt.uploadHandler)
+	pt.serveMux.HandleFunc("GET /api/attachments/{id}", pt.downloadHandler)
+	pt.serveMux.HandleFunc("GET /api/attachments/{id}/thumbnail", pt.thumbnailHandler)
+	pt.serveMux.HandleFunc("GET /api/trash", pt.trashHandler)
+	pt.serveMux.HandleFunc("GET /api/tags", pt.tagsHandler)
+	pt.serveMux.HandleFunc("GET /api/collections", pt.collectionsHandler)
+	pt.serveMux.HandleFunc("GET /api/collections/{id}", pt.collectionHandler)
+	pt.serveMux.HandleFunc("GET /api/scheduled", pt.scheduledHandler)
+	pt.serveMux.HandleFunc("DELETE /api/scheduled/{id}", pt.cancelScheduledHandler)
+	pt.serveMux.HandleFunc("GET /api/export", pt.exportHandler)
+	pt.serveMux.HandleFunc("POST /api/import", pt.importHandler)
+	pt.serveMux.HandleFunc("GET /api/settings", pt.settingsHandler)
+	pt.serveMux.HandleFunc("PUT /api/settings", pt.saveSettingsHandler)
+	pt.registerAdminRoutes()
+	pt.startSecretJanitor()
+	pt.startTrashJanitor()
+	pt.startBackups()
+	pt.startScheduler()
 
 	return pt, nil
 }
 
-func (p *ptServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.serveMux.ServeHTTP(w, r)
+// Close stops background work, disconnects clients and closes the database once they
+// are done with it, as they may be in the middle of a transaction.
+func (p *ptServer) Close() error {
+	p.mu.Lock()
+	close(p.done)
+	var conns []*websocket.Conn
+	for c := range p.clients {
+		conns = append(conns, c.conn)
+	}
+	p.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.CloseNow()
+	}
+	p.background.Wait()
+	return p.dbm.Close()
 }
 
-func (p *ptServer) getRequestIP(r *http.Request) string {
-	requestIP := r.Header.Get("X-forwarded-for")
-	if requestIP == "" {
-		requestIP = r.RemoteAddr
+// newNameGenerator creates the device name generator, loading custom word lists and
+// the blocklist from the files named by the NAMES_ADJECTIVES_FILE, NAMES_NOUNS_FILE
+// and NAMES_BLOCKLIST_FILE environment variables when they are set.
+func newNameGenerator() (*data.NameGenerator, error) {
+	names := data.NewNameGenerator(time.Now().UnixNano())
+
+	err := names.LoadWords(os.Getenv("NAMES_ADJECTIVES_FILE"), os.Getenv("NAMES_NOUNS_FILE"))
+	if err != nil {
+		return nil, err
 	}
-	return strings.Split(requestIP, ":")[0]
+
+	if blocklist := os.Getenv("NAMES_BLOCKLIST_FILE"); blocklist != "" {
+		if err := names.LoadBlocklist(blocklist); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// newAcceptOptions returns the websocket accept options. Only pages served from the same
+// host may open a socket unless extra origin host patterns are listed, comma separated,
+// in ALLOWED_ORIGINS. Setting INSECURE_SKIP_ORIGIN_CHECK to true disables the check
+// entirely and is only meant for local development.
+func newAcceptOptions() (*websocket.AcceptOptions, error) {
+	opts := &websocket.AcceptOptions{
+		Subprotocols: []string{subprotocol},
+	}
+
+	for _, pattern := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid origin pattern %q: %w", pattern, err)
+		}
+		opts.OriginPatterns = append(opts.OriginPatterns, pattern)
+	}
+
+	if skip, _ := strconv.ParseBool(os.Getenv("INSECURE_SKIP_ORIGIN_CHECK")); skip {
+		log.Printf("warning: websocket origin check disabled, do not use in production\n")
+		opts.InsecureSkipVerify = true
+	}
+
+	return opts, nil
+}
+
+func (p *ptServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if bannable(r.URL.Path) && p.isBanned(p.getRequestIP(r)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if limited(r.URL.Path) && !p.allow(p.getRequestIP(r)) {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if p.crossOrigin(r) {
+		http.Error(w, "Cross-origin request refused", http.StatusForbidden)
+		return
+	}
+
+	if requiresAuth(r.URL.Path) {
+		ok, err := p.authorized(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	p.serveMux.ServeHTTP(w, r)
 }
 
 func (p *ptServer) idHandler(w http.ResponseWriter, r *http.Request) {
@@ -86,11 +330,18 @@ func (p *ptServer) idHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The page asks for its identity before connecting, which gives it a device ID
+	if _, err := p.issueDevice(w, r); err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/josn")
 	idn := struct {
 		Friendly_name string `json:"friendly_name"`
 		IPaddress     string `json:"ipaddress"`
-	}{Friendly_name: data.GenerateName(), IPaddress: p.getRequestIP(r)}
+	}{IPaddress: p.getRequestIP(r)}
+	idn.Friendly_name = p.names.Suggest(idn.IPaddress)
 
 	idJson, err := json.Marshal(idn)
 	if err != nil {
@@ -107,9 +358,13 @@ func (p *ptServer) joinHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-		Subprotocols: []string{subprotocol},
-	})
+	network := p.getRequestIP(r)
+	author, err := p.issueDevice(w, r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	conn, err := websocket.Accept(w, r, p.accept)
 	if err != nil {
 		log.Printf("%v\n", err)
 		return
@@ -122,18 +377,42 @@ func (p *ptServer) joinHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ua := useragent.Parse(r.UserAgent())
 	c := &client{
 		conn:    conn,
 		message: clientMessage{},
-		network: p.getRequestIP(r),
-		device:  fmt.Sprintf("%s-%s", ua.OS, ua.Name),
+		network: network,
+		device:  deviceName(r),
+		author:  author,
+		kind:    deviceType(useragent.Parse(r.UserAgent())),
+		name:    r.URL.Query().Get("name"),
+		events:  r.URL.Query().Has("events"),
+
+		connected: time.Now(),
+
+		outbox: make(chan any, outboxSize),
+		closed: make(chan struct{}),
 	}
+	go c.writeMessages()
+	defer close(c.closed)
+
+	// Attachments can be sent in binary frames
+	conn.SetReadLimit(p.maxAttachment + 64<<10)
 
-	p.clients[c] = struct{}{}
+	if !p.addClient(c) {
+		conn.Close(websocket.StatusGoingAway, "server is shutting down")
+		return
+	}
+	defer p.background.Done()
+	defer p.removeClient(c)
 	p.joinClient(c)
 }
 
+// deviceName describes the device of the request from its user agent.
+func deviceName(r *http.Request) string {
+	ua := useragent.Parse(r.UserAgent())
+	return fmt.Sprintf("%s-%s", ua.OS, ua.Name)
+}
+
 // joinClient is a method that will be called when a new client connects to the server.
 // c is a pointer to a client struct.
 func (p *ptServer) joinClient(c *client) {
@@ -154,9 +433,13 @@ func (p *ptServer) joinClient(c *client) {
 
 	emsg := <-sendErrMsgChan
 	if emsg != nil {
-		log.Printf("error sending initial message to client: %v\n", emsg)
+		p.logError("error sending initial message to client: %v\n", emsg)
 		c.conn.CloseNow()
-		delete(p.clients, c)
+		p.removeClient(c)
+	}
+	if c.events {
+		p.sendCollections(c)
+		p.sendScheduled(c, true)
 	}
 
 	//Read messages from client
@@ -171,7 +454,7 @@ func (p *ptServer) joinClient(c *client) {
 			if chanResult.err != context.DeadlineExceeded {
 				log.Printf("error reading message from client: %v\n", chanResult.err)
 				c.conn.CloseNow()
-				delete(p.clients, c)
+				p.removeClient(c)
 				return
 			} else {
 				continue
@@ -179,19 +462,116 @@ func (p *ptServer) joinClient(c *client) {
 		}
 		newClientMessage = chanResult.content.(clientMessage)
 
-		if newClientMessage.Action == "add" {
+		if !p.allow(c.network) {
+			c.sendEvent(serverEvent{Event: "error", Message: "Too many messages, slow down"})
+			continue
+		}
+
+		switch newClientMessage.Action {
+		case "add":
+			if err := validateEncryption(newClientMessage); err != nil {
+				c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+				continue
+			}
 			newClientMessage.Network = c.network
 			newClientMessage.Device = c.device
+			newClientMessage.User = p.clientName(c)
+			newClientMessage.Author = c.author
+			if newClientMessage.ParentId != 0 && newClientMessage.PublishAt != "" {
+				c.sendEvent(serverEvent{Event: "error", Message: "replies cannot be scheduled"})
+				continue
+			}
+			if newClientMessage.ParentId != 0 {
+				p.replyPaste(c, newClientMessage)
+				continue
+			}
+			if newClientMessage.PublishAt != "" {
+				p.schedulePaste(c, newClientMessage)
+				continue
+			}
 			p.persistMessageFromClient(newClientMessage)
-		} else {
-			//The only other action is delete
-			p.deletePaste(int64(newClientMessage.Id))
+		case "rename":
+			if err := p.renameClient(c, newClientMessage.Text); err != nil {
+				c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+			}
+			continue
+		case "list":
+			if pastes, err := p.dbm.GetPastes(c.network); err == nil {
+				c.sendMessageToClient(pastes)
+			}
+			continue
+		case "reveal":
+			p.revealPaste(c, int64(newClientMessage.Id))
+			continue
+		case "consume":
+			p.consumePaste(c, int64(newClientMessage.Id))
+			continue
+		case "upload", "image":
+			if newClientMessage.Data == nil {
+				c.sendEvent(serverEvent{Event: "error", Message: "uploads must be sent in a binary frame"})
+				continue
+			}
+			paste := data.Paste{Network: c.network, Device: c.device, User: p.clientName(c), Author: c.author}
+			store := p.storeAttachment
+			if newClientMessage.Action == "image" {
+				store = p.storeClipboardImage
+			}
+			if _, err := store(paste, newClientMessage.Text, newClientMessage.Data); err != nil {
+				if !clientError(err) {
+					p.logError("error storing attachment: %v\n", err)
+				}
+				c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+				continue
+			}
+		case "edit":
+			if !p.editPaste(c, newClientMessage) {
+				continue
+			}
+		case "pin", "unpin":
+			if !p.pinPaste(c, int64(newClientMessage.Id), newClientMessage.Action == "pin") {
+				continue
+			}
+		case "react":
+			p.reactPaste(c, int64(newClientMessage.Id), newClientMessage.Emoji)
+			continue
+		case "tag":
+			if !p.tagPaste(c, int64(newClientMessage.Id), newClientMessage.Tags) {
+				continue
+			}
+		case "create_collection", "rename_collection", "delete_collection":
+			if !p.changeCollection(c, newClientMessage) {
+				continue
+			}
+		case "move":
+			if !p.movePaste(c, int64(newClientMessage.Id), newClientMessage.CollectionId) {
+				continue
+			}
+		case "delete":
+			if !p.deletePaste(c, int64(newClientMessage.Id)) {
+				continue
+			}
+		case "clear_network", "delete_many", "delete_before":
+			p.bulkDeleteClient(c, newClientMessage)
+			continue
+		case "restore", "undo":
+			if !p.restorePaste(c, int64(newClientMessage.Id)) {
+				continue
+			}
+		case "trash":
+			p.sendTrash(c)
+			continue
+		case "scheduled":
+			p.sendScheduled(c, false)
+			continue
+		case "cancel":
+			p.cancelScheduled(c, int64(newClientMessage.Id))
+			continue
+		default:
+			c.sendEvent(serverEvent{Event: "error", Message: fmt.Sprintf("unknown action %q", newClientMessage.Action)})
+			continue
 		}
 
-		pastes, err := p.dbm.GetPastes(c.network)
-		if err == nil {
-			p.publishMessageToClients(pastes)
-		}
+		p.publishPastes(c.network)
 	}
 }
 
@@ -200,36 +580,50 @@ func (p *ptServer) persistMessageFromClient(msg clientMessage) {
 	paste := data.Paste{
 		User:      msg.User,
 		Device:    msg.Device,
+		Author:    msg.Author,
 		Network:   msg.Network,
 		Content:   msg.Text,
 		CreatedAt: time.Now(),
+
+		Encryption: msg.Encryption,
+		OneTime:    msg.OneTime,
 	}
 	_, err := p.dbm.InsertPaste(paste)
 	if err != nil {
-		log.Printf("error inserting paste: %v\n", err)
+		p.logError("error inserting paste: %v\n", err)
 	}
 }
 
-func (p *ptServer) deletePaste(id int64) {
-	err := p.dbm.DeletePaste(id)
-	if err != nil {
-		log.Printf("error deleting paste: %v\n", err)
+// validateEncryption checks that an encrypted paste uses a known scheme and looks like
+// ciphertext, without being able to read it.
+func validateEncryption(msg clientMessage) error {
+	switch msg.Encryption {
+	case "":
+		return nil
+	case data.EncryptionE2E:
+		if !e2e.Valid(msg.Text) {
+			return errors.New("encrypted paste is malformed")
+		}
+		return nil
 	}
+	return fmt.Errorf("unknown encryption %q", msg.Encryption)
 }
 
-// publishMessageToClients is a method that sends a message to all clients.
-func (p *ptServer) publishMessageToClients(pastes []data.Paste) {
-	var wg sync.WaitGroup
-
-	for c := range p.clients {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			c.sendMessageToClient(pastes)
-		}()
+// publishPastes sends the current pastes of the network to all its clients.
+func (p *ptServer) publishPastes(network string) {
+	pastes, err := p.dbm.GetPastes(network)
+	if err != nil {
+		p.logError("error fetching pastes: %v\n", err)
+		return
 	}
+	p.publishMessageToClients(network, pastes)
+}
 
-	wg.Wait()
+// publishMessageToClients is a method that sends a message to all clients on the network.
+func (p *ptServer) publishMessageToClients(network string, pastes []data.Paste) {
+	for _, c := range p.networkClients(network) {
+		c.sendMessageToClient(pastes)
+	}
 }
 
 // readMessageFromClient is a method that reads messages from the client.
@@ -240,7 +634,14 @@ func (c *client) readMessageFromClient(msgChan chan<- chanData) {
 
 	var message clientMessage
 
-	err := wsjson.Read(ctx, c.conn, &message)
+	typ, b, err := c.conn.Read(ctx)
+	if err == nil {
+		if typ == websocket.MessageBinary {
+			message, err = parseBinaryMessage(b)
+		} else {
+			err = json.Unmarshal(b, &message)
+		}
+	}
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			err = ctx.Err()
@@ -252,15 +653,46 @@ func (c *client) readMessageFromClient(msgChan chan<- chanData) {
 	msgChan <- chanData{content: message, err: nil}
 }
 
-// sendMessageToClient is a method that sends a message to a client.
+// sendMessageToClient is a method that sends a message to a client. One-time pastes and
+// detected secrets are masked.
 func (c *client) sendMessageToClient(pastes []data.Paste) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
+	return c.send(maskPastes(pastes))
+}
 
-	err := wsjson.Write(ctx, c.conn, pastes)
-	if err != nil {
-		log.Printf("error writing message: %v\n", err)
-		return err
+// send queues a message to be written to the client after the messages sent before it.
+// A client whose queue is full is disconnected rather than slowing the server down.
+func (c *client) send(v any) error {
+	select {
+	case <-c.closed:
+		return errClientGone
+	default:
+	}
+
+	select {
+	case c.outbox <- v:
+		return nil
+	default:
+		log.Printf("client %s is too slow, disconnecting\n", c.network)
+		c.conn.CloseNow()
+		return errClientGone
+	}
+}
+
+// writeMessages writes the queued messages to the client in order until it is gone.
+func (c *client) writeMessages() {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case v := <-c.outbox:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			err := wsjson.Write(ctx, c.conn, v)
+			cancel()
+			if err != nil {
+				log.Printf("error writing message: %v\n", err)
+				c.conn.CloseNow()
+				return
+			}
+		}
 	}
-	return nil
 }
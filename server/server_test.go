@@ -232,6 +232,109 @@ func TestPasteDeletion(t *testing.T) {
 	}
 }
 
+func TestEncryptedPasteSubmission(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	for _, msg := range []map[string]string{
+		{"action": "add", "text": "plain text", "encryption": data.EncryptionE2E},
+		{"action": "add", "text": "plain text", "encryption": "rot13"},
+	} {
+		if err := wsjson.Write(ctx, c, msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		readEvent(t, ctx, c, "error")
+	}
+
+	envelope := "v2:EBESExQVFhcYGRobHB0eHw==:AAECAwQFBgcICQoL:XTDaBD3XHxEmS/OY8SOSZ/2O9bpC2YZBiGUSAXTORq3cUii8pCKV"
+	msg := map[string]string{"action": "add", "text": envelope, "encryption": data.EncryptionE2E}
+	if err := wsjson.Write(ctx, c, msg); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 1 || pastes[0].Content != envelope || pastes[0].Encryption != data.EncryptionE2E {
+		t.Errorf("Expected the ciphertext to be stored as is, got %v", pastes)
+	}
+}
+
+func TestWebsocketOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		skip    string
+		origin  string
+		wantErr bool
+	}{
+		{name: "no origin", origin: ""},
+		{name: "same host", origin: "same"},
+		{name: "foreign origin", origin: "https://evil.example", wantErr: true},
+		{name: "null origin", origin: "null", wantErr: true},
+		{name: "allowed pattern", allowed: "*.example.com", origin: "https://app.example.com"},
+		{name: "not matching pattern", allowed: "*.example.com", origin: "https://example.org", wantErr: true},
+		{name: "dev override", skip: "true", origin: "https://evil.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_ORIGINS", tt.allowed)
+			t.Setenv("INSECURE_SKIP_ORIGIN_CHECK", tt.skip)
+
+			server, _ := setupTest(t)
+			defer teardownTest(server)
+
+			s := httptest.NewServer(server.Handler)
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			header := http.Header{}
+			if tt.origin == "same" {
+				header.Set("Origin", s.URL)
+			} else if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			c, resp, err := websocket.Dial(ctx, s.URL+"/ws", &websocket.DialOptions{
+				Subprotocols: []string{subprotocol},
+				HTTPHeader:   header,
+			})
+			if tt.wantErr {
+				if err == nil {
+					c.CloseNow()
+					t.Fatalf("Expected origin %v to be rejected", tt.origin)
+				}
+				if resp == nil || resp.StatusCode != http.StatusForbidden {
+					t.Errorf("Expected status code 403, got %v", resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected origin %v to be accepted, got %v", tt.origin, err)
+			}
+			c.Close(websocket.StatusNormalClosure, "closing connection")
+		})
+	}
+}
+
+func TestInvalidOriginPattern(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "[")
+	if _, err := newAcceptOptions(); err == nil {
+		t.Errorf("Expected an error for a malformed origin pattern")
+	}
+}
+
 func setupTest(t *testing.T) (*http.Server, *ptServer) {
 	// Use a test database file
 	os.Setenv("DB_FILE", testDbFile)
@@ -255,7 +358,57 @@ func teardownTest(server *http.Server) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 	server.Shutdown(ctx)
+	if pts, ok := server.Handler.(*ptServer); ok {
+		pts.Close()
+	}
 
 	os.Remove(testDbFile)
 	os.Setenv("DB_FILE", "")
 }
+
+// dialEvents opens a websocket that accepts event frames, optionally asking for a device name.
+func dialEvents(t *testing.T, ctx context.Context, url string, name string) *websocket.Conn {
+	t.Helper()
+
+	c, _, err := websocket.Dial(ctx, url+"/ws?events=1&name="+name, &websocket.DialOptions{
+		Subprotocols: []string{subprotocol}})
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	return c
+}
+
+// readEvent reads frames until an event with the given name arrives, skipping paste lists and other events.
+func readEvent(t *testing.T, ctx context.Context, c *websocket.Conn, event string) map[string]interface{} {
+	t.Helper()
+
+	for {
+		var frame interface{}
+		if err := wsjson.Read(ctx, c, &frame); err != nil {
+			t.Fatalf("Failed to read %v event: %v", event, err)
+		}
+		if ev, ok := frame.(map[string]interface{}); ok && ev["event"] == event {
+			return ev
+		}
+	}
+}
+
+// readPastes reads frames until a paste list arrives, skipping events.
+func readPastes(t *testing.T, ctx context.Context, c *websocket.Conn) []data.Paste {
+	t.Helper()
+
+	for {
+		_, b, err := c.Read(ctx)
+		if err != nil {
+			t.Fatalf("Failed to read pastes: %v", err)
+		}
+		if len(b) > 0 && b[0] == '{' {
+			continue
+		}
+		var pastes []data.Paste
+		if err := json.Unmarshal(b, &pastes); err != nil {
+			t.Fatalf("Failed to unmarshal pastes: %v", err)
+		}
+		return pastes
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// settingsDTO is the JSON representation of the settings of a network. The dedup window
+// is a duration like "10m", empty or "0s" uses the server default.
+type settingsDTO struct {
+	Dedup       bool   `json:"dedup"`
+	DedupWindow string `json:"dedup_window"`
+}
+
+func newSettingsDTO(s data.Settings) settingsDTO {
+	dto := settingsDTO{Dedup: s.Dedup}
+	if s.DedupWindow > 0 {
+		dto.DedupWindow = s.DedupWindow.String()
+	}
+	return dto
+}
+
+// settingsHandler returns the settings of the caller's network.
+func (p *ptServer) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := p.dbm.GetSettings(p.getRequestIP(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, newSettingsDTO(settings))
+}
+
+// saveSettingsHandler replaces the settings of the caller's network.
+func (p *ptServer) saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var req settingsDTO
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	settings := data.Settings{Dedup: req.Dedup}
+	if req.DedupWindow != "" {
+		window, err := time.ParseDuration(req.DedupWindow)
+		if err != nil || window < 0 {
+			http.Error(w, fmt.Sprintf("Invalid dedup_window %q, expected a duration like 10m", req.DedupWindow), http.StatusBadRequest)
+			return
+		}
+		settings.DedupWindow = window.Truncate(time.Second)
+	}
+
+	if err := p.dbm.SaveSettings(p.getRequestIP(r), settings); err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, newSettingsDTO(settings))
+}
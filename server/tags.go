@@ -0,0 +1,41 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// tagPaste replaces the manual tags of a paste of the client's network. It reports
+// whether the paste changed, otherwise the client was sent an error.
+func (p *ptServer) tagPaste(c *client, id int64, tags []string) bool {
+	err := p.dbm.SetTags(id, c.network, tags)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+	case errors.Is(err, data.ErrInvalidTag), errors.Is(err, data.ErrTooManyTags):
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+	default:
+		p.logError("error tagging paste: %v\n", err)
+	}
+	return false
+}
+
+// tagsHandler returns the tags of the caller's network with the number of pastes
+// having each, most used first.
+func (p *ptServer) tagsHandler(w http.ResponseWriter, r *http.Request) {
+	counts, err := p.dbm.TagCounts(p.getRequestIP(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if counts == nil {
+		counts = []data.TagCount{}
+	}
+	writeJSON(w, counts)
+}
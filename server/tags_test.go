@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestTagPaste(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "ssh deploy@host #ops", CreatedAt: time.Now()})
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "not yours", CreatedAt: time.Now()})
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "tag", "id": id, "tags": []string{"servers"}}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, c)
+	if len(pastes) != 1 || fmt.Sprint(pastes[0].Tags) != "[ops servers]" {
+		t.Errorf("Expected the paste to be tagged, got %v", pastes)
+	}
+
+	for _, msg := range []map[string]any{
+		{"action": "tag", "id": other, "tags": []string{"mine"}},
+		{"action": "tag", "id": id, "tags": []string{"not a tag"}},
+	} {
+		if err := wsjson.Write(ctx, c, msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		readEvent(t, ctx, c, "error")
+	}
+}
+
+func TestTagsEndpoints(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "#meeting at 10", CreatedAt: time.Now()})
+	pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "#meeting notes #q3", CreatedAt: time.Now()})
+	pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "#meeting elsewhere", CreatedAt: time.Now()})
+
+	w := authRequest(server.Handler, http.MethodGet, "/api/tags", "", nil)
+	var counts []data.TagCount
+	json.NewDecoder(w.Body).Decode(&counts)
+	if fmt.Sprint(counts) != "[{meeting 2} {q3 1}]" {
+		t.Errorf("Expected the tag counts of the network, got %v", counts)
+	}
+
+	w = authRequest(server.Handler, http.MethodGet, "/api/pastes?tag=%23Meeting&tag=q3", "", nil)
+	var pastes []data.Paste
+	json.NewDecoder(w.Body).Decode(&pastes)
+	if len(pastes) != 1 || pastes[0].Content != "#meeting notes #q3" {
+		t.Errorf("Expected the paste with both tags, got %v", pastes)
+	}
+
+	if w := authRequest(server.Handler, http.MethodGet, "/api/pastes?tag=a+b", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid tag to be refused, got %v", w.Code)
+	}
+}
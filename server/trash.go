@@ -0,0 +1,166 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+)
+
+// defaultTrashWindow is how long deleted pastes can be restored unless TRASH_WINDOW says otherwise.
+const defaultTrashWindow = time.Hour
+
+// newTrashWindow returns how long deleted pastes stay in the trash from TRASH_WINDOW.
+// A window of 0 deletes pastes right away without a trash.
+func newTrashWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("TRASH_WINDOW")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultTrashWindow
+}
+
+// Delete policies, set with DELETE_POLICY.
+const (
+	// deleteNetwork lets every device of the network delete its pastes.
+	deleteNetwork = "network"
+	// deleteAuthor only lets the device that pasted a paste delete it. The admin API can
+	// still delete any paste.
+	deleteAuthor = "author"
+)
+
+// newDeletePolicy returns the delete policy from DELETE_POLICY, deleteNetwork by default.
+func newDeletePolicy() (string, error) {
+	switch policy := os.Getenv("DELETE_POLICY"); policy {
+	case "":
+		return deleteNetwork, nil
+	case deleteNetwork, deleteAuthor:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid DELETE_POLICY %q, expected %q or %q", policy, deleteNetwork, deleteAuthor)
+	}
+}
+
+// canDelete reports whether the client may delete the paste. The paste must belong to the
+// client's network, and under the author policy be pasted by the client.
+func (p *ptServer) canDelete(c *client, paste data.Paste) bool {
+	if paste.Network != c.network {
+		return false
+	}
+	return p.deletePolicy == deleteNetwork || p.isAuthor(c, paste)
+}
+
+// deletePaste moves a paste of the client's network to the trash, or deletes it when
+// there is no trash, and tells the network who deleted it. It reports whether the paste
+// was deleted, otherwise the client was sent an error.
+func (p *ptServer) deletePaste(c *client, id int64) bool {
+	paste, err := p.dbm.GetPaste(id)
+	if err != nil || paste.Network != c.network {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			p.logError("error deleting paste: %v\n", err)
+		}
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+		return false
+	}
+	if !p.canDelete(c, paste) {
+		c.sendEvent(serverEvent{Event: "error", Message: "only the device that pasted it can delete this paste"})
+		return false
+	}
+
+	by := p.clientName(c)
+	if p.trashWindow > 0 {
+		paste, err = p.dbm.TrashPaste(id, c.network, by, time.Now())
+	} else {
+		err = p.dbm.DeletePaste(id)
+		now := time.Now()
+		paste.DeletedAt, paste.DeletedBy = &now, by
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			p.logError("error deleting paste: %v\n", err)
+		}
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+		return false
+	}
+
+	masked := maskPastes([]data.Paste{paste})[0]
+	p.publishEvent(paste.Network, serverEvent{Event: "delete", Paste: &masked}, nil)
+	return true
+}
+
+// restorePaste takes a paste of the client's network out of the trash. Without an ID it
+// restores the paste the client deleted last. It reports whether a paste was restored.
+func (p *ptServer) restorePaste(c *client, id int64) bool {
+	since := time.Now().Add(-p.trashWindow)
+
+	var err error
+	if id == 0 {
+		id, err = p.dbm.LastTrashed(c.network, p.clientName(c), since)
+	}
+	var paste data.Paste
+	if err == nil {
+		paste, err = p.dbm.RestorePaste(id, c.network, since)
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			p.logError("error restoring paste: %v\n", err)
+		}
+		c.sendEvent(serverEvent{Event: "error", Message: "nothing to restore"})
+		return false
+	}
+
+	masked := maskPastes([]data.Paste{paste})[0]
+	p.publishEvent(c.network, serverEvent{Event: "restore", Paste: &masked}, nil)
+	return true
+}
+
+// sendTrash sends the pastes in the trash of the client's network to the client.
+func (p *ptServer) sendTrash(c *client) {
+	pastes, err := p.dbm.TrashedPastes(c.network, time.Now().Add(-p.trashWindow))
+	if err != nil {
+		p.logError("error fetching trash: %v\n", err)
+		return
+	}
+	c.sendEvent(serverEvent{Event: "trash", Pastes: maskPastes(pastes)})
+}
+
+// trashHandler returns the pastes in the trash of the caller's network as JSON, most
+// recently deleted first.
+func (p *ptServer) trashHandler(w http.ResponseWriter, r *http.Request) {
+	pastes, err := p.dbm.TrashedPastes(p.getRequestIP(r), time.Now().Add(-p.trashWindow))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, maskPastes(pastes))
+}
+
+// startTrashJanitor deletes pastes for good once they spent TRASH_WINDOW in the trash.
+func (p *ptServer) startTrashJanitor() {
+	if p.trashWindow <= 0 {
+		return
+	}
+
+	interval := min(p.trashWindow/4, maxJanitorInterval)
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				if _, err := p.dbm.PurgeTrash(time.Now().Add(-p.trashWindow)); err != nil {
+					p.logError("error purging trash: %v\n", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestTrashAndUndo(t *testing.T) {
+	server, _ := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	other := dialEvents(t, ctx, s.URL, "CALM-HERON")
+	defer other.CloseNow()
+	readPastes(t, ctx, other)
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "add", "text": "hello"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, c)
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "delete", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, other, "delete")
+	if paste, _ := ev["paste"].(map[string]interface{}); paste == nil || paste["DeletedBy"] != "BRAVE-OTTER" {
+		t.Errorf("Expected deletion to name who deleted it, got %v", ev)
+	}
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "trash"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev = readEvent(t, ctx, c, "trash")
+	if trash, _ := ev["pastes"].([]interface{}); len(trash) != 1 {
+		t.Errorf("Expected deleted paste in the trash, got %v", ev)
+	}
+
+	// Other devices cannot undo someone else's deletion, but can restore it by ID
+	if err := wsjson.Write(ctx, other, map[string]any{"action": "undo"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, other, "error")
+
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "undo"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, other, "restore")
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "list"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if pastes := readPastes(t, ctx, c); len(pastes) != 1 || pastes[0].Content != "hello" {
+		t.Errorf("Expected paste to be restored, got %v", pastes)
+	}
+}
+
+func TestTrashEndpoint(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", Content: "Tr0ub4dor&3", CreatedAt: time.Now()})
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "not yours", CreatedAt: time.Now()})
+	pts.dbm.TrashPaste(id, "192.0.2.1", "BRAVE-OTTER", time.Now())
+	pts.dbm.TrashPaste(other, "198.51.100.1", "CALM-HERON", time.Now())
+
+	w := authRequest(server.Handler, http.MethodGet, "/api/trash", "", nil)
+	var pastes []data.Paste
+	json.NewDecoder(w.Body).Decode(&pastes)
+	if w.Code != http.StatusOK || len(pastes) != 1 || pastes[0].Content != maskedContent || pastes[0].DeletedBy != "BRAVE-OTTER" {
+		t.Errorf("Expected the masked trash of the network, got %v %v", w.Code, pastes)
+	}
+}
+
+func TestTrashDisabled(t *testing.T) {
+	t.Setenv("TRASH_WINDOW", "0")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", Content: "gone", CreatedAt: time.Now()})
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "delete", "id": id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, c, "delete")
+
+	if trash, _ := pts.dbm.TrashedPastes("127.0.0.1", time.Time{}); len(trash) != 0 {
+		t.Errorf("Expected paste to be deleted without a trash, got %v", trash)
+	}
+}
+
+func TestDeleteOtherNetwork(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "BRAVE-OTTER", Content: "not yours", CreatedAt: time.Now()})
+
+	// Guessing the ID of another network's paste is refused, as is an unknown ID
+	for _, id := range []int64{other, other + 100} {
+		if err := wsjson.Write(ctx, c, map[string]any{"action": "delete", "id": id}); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		if ev := readEvent(t, ctx, c, "error"); ev["message"] != "paste not found" {
+			t.Errorf("Expected deletion of paste %v to be refused, got %v", id, ev)
+		}
+	}
+
+	if paste, err := pts.dbm.GetPaste(other); err != nil || paste.DeletedAt != nil {
+		t.Errorf("Expected paste of another network to be kept, got %v %v", paste, err)
+	}
+	if trash, _ := pts.dbm.TrashedPastes("192.0.2.1", time.Time{}); len(trash) != 0 {
+		t.Errorf("Expected nothing in the trash of the other network, got %v", trash)
+	}
+}
+
+func TestDeletePolicyAuthor(t *testing.T) {
+	t.Setenv("DELETE_POLICY", "author")
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	author := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer author.CloseNow()
+	readPastes(t, ctx, author)
+
+	guest := dialEvents(t, ctx, s.URL, "CALM-HERON")
+	defer guest.CloseNow()
+	readPastes(t, ctx, guest)
+
+	admin := dialEvents(t, ctx, s.URL, "OFFICE-ADMIN")
+	defer admin.CloseNow()
+	readPastes(t, ctx, admin)
+
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "add", "text": "first"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readPastes(t, ctx, author)
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "add", "text": "second"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, author)
+
+	if err := wsjson.Write(ctx, guest, map[string]any{"action": "delete", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, guest, "error")
+
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "delete", "id": pastes[0].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, author, "delete")
+	readEvent(t, ctx, admin, "delete")
+
+	// Device names are chosen by the devices, so no name lets a device delete every paste
+	if err := wsjson.Write(ctx, admin, map[string]any{"action": "delete", "id": pastes[1].Id}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, admin, "error")
+
+	// The admin API can delete every paste
+	if w := adminRequest(server.Handler, http.MethodDelete, fmt.Sprintf("/admin/api/pastes/%d", pastes[1].Id), "", testAdminToken); w.Code >= 300 {
+		t.Errorf("Expected the admin API to delete the paste, got %v", w.Code)
+	}
+
+	if live, _ := pts.dbm.GetPastes("127.0.0.1"); len(live) != 0 {
+		t.Errorf("Expected both pastes to be deleted, got %v", live)
+	}
+}
+
+func TestDeletePolicyInvalid(t *testing.T) {
+	t.Setenv("DELETE_POLICY", "everyone")
+	if _, err := newDeletePolicy(); err == nil {
+		t.Errorf("Expected invalid DELETE_POLICY to be refused")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kuiadev/pastytext/data"
+	"github.com/kuiadev/pastytext/detect"
+	"github.com/kuiadev/pastytext/diff"
+)
+
+// Edit policies, set with EDIT_POLICY.
+const (
+	// editAuthor only lets the device that pasted a paste edit it.
+	editAuthor = "author"
+	// editAnyone lets every device of the network edit its pastes.
+	editAnyone = "anyone"
+)
+
+// newEditPolicy returns the edit policy from EDIT_POLICY, editAuthor by default.
+func newEditPolicy() (string, error) {
+	switch policy := os.Getenv("EDIT_POLICY"); policy {
+	case "":
+		return editAuthor, nil
+	case editAuthor, editAnyone:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid EDIT_POLICY %q, expected %q or %q", policy, editAuthor, editAnyone)
+	}
+}
+
+// isAuthor reports whether the client is the device that pasted the paste, which is
+// known by the ID in its signed device cookie. Pastes made over the API have no author.
+func (p *ptServer) isAuthor(c *client, paste data.Paste) bool {
+	return paste.Author != "" && paste.Author == c.author
+}
+
+// editPaste replaces the content of a paste with the text of the message and tells the
+// network about it. It reports whether the paste was edited.
+func (p *ptServer) editPaste(c *client, msg clientMessage) bool {
+	if err := validateEncryption(msg); err != nil {
+		c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+		return false
+	}
+
+	paste, err := p.dbm.GetPaste(int64(msg.Id))
+	if err != nil || paste.Network != c.network {
+		c.sendEvent(serverEvent{Event: "error", Message: "paste not found"})
+		return false
+	}
+	if p.editPolicy == editAuthor && !p.isAuthor(c, paste) {
+		c.sendEvent(serverEvent{Event: "error", Message: "only the device that pasted it can edit this paste"})
+		return false
+	}
+
+	edit := data.Paste{Network: c.network, User: p.clientName(c), Content: msg.Text, Encryption: msg.Encryption, CreatedAt: time.Now()}
+	paste, err = p.dbm.EditPaste(paste.Id, edit)
+	if err != nil {
+		if errors.Is(err, data.ErrNotEditable) {
+			c.sendEvent(serverEvent{Event: "error", Message: err.Error()})
+		} else {
+			p.logError("error editing paste: %v\n", err)
+		}
+		return false
+	}
+
+	masked := maskPastes([]data.Paste{paste})[0]
+	p.publishEvent(c.network, serverEvent{Event: "edit", Paste: &masked}, nil)
+	return true
+}
+
+// versionsHandler returns every version of a paste of the caller's network as JSON,
+// oldest first. Versions containing a secret are masked.
+func (p *ptServer) versionsHandler(w http.ResponseWriter, r *http.Request) {
+	versions, ok := p.findVersions(w, r)
+	if !ok {
+		return
+	}
+	for i, v := range versions {
+		if v.Secret != detect.None {
+			versions[i].Content = maskedContent
+		}
+	}
+	writeJSON(w, versions)
+}
+
+// diffHandler returns the changes between two versions of a paste of the caller's
+// network as a unified diff. The from and to query parameters are version numbers and
+// default to the version before the current one and the current one.
+func (p *ptServer) diffHandler(w http.ResponseWriter, r *http.Request) {
+	versions, ok := p.findVersions(w, r)
+	if !ok {
+		return
+	}
+
+	to, err := versionParam(r, "to", versions[len(versions)-1].Number, len(versions))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := versionParam(r, "from", max(to-1, 1), len(versions))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a, b := versions[from-1], versions[to-1]
+	if a.Encryption != "" || b.Encryption != "" {
+		http.Error(w, "Encrypted versions can only be compared by clients", http.StatusBadRequest)
+		return
+	}
+	if a.Secret != detect.None || b.Secret != detect.None {
+		http.Error(w, "Versions containing a secret cannot be compared", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, diff.Unified(fmt.Sprintf("version %d", from), fmt.Sprintf("version %d", to), a.Content, b.Content))
+}
+
+// findVersions returns the versions of the paste named in the path, or writes an error.
+func (p *ptServer) findVersions(w http.ResponseWriter, r *http.Request) ([]data.Version, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	versions, err := p.dbm.Versions(id, p.getRequestIP(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal server error %s", err.Error()), http.StatusInternalServerError)
+		return nil, false
+	}
+	return versions, true
+}
+
+// versionParam parses a version number from the query, which must be between 1 and last.
+func versionParam(r *http.Request, name string, def, last int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > last {
+		return 0, fmt.Errorf("%s must be a version between 1 and %d", name, last)
+	}
+	return n, nil
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/kuiadev/pastytext/data"
+)
+
+func TestEditPaste(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	author := dialEvents(t, ctx, s.URL, "BRAVE-OTTER")
+	defer author.CloseNow()
+	readPastes(t, ctx, author)
+
+	other := dialEvents(t, ctx, s.URL, "CALM-HERON")
+	defer other.CloseNow()
+	readPastes(t, ctx, other)
+
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "add", "text": "https://staging.example.com"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, author)
+	readPastes(t, ctx, other)
+
+	// Only the author may edit by default
+	if err := wsjson.Write(ctx, other, map[string]any{"action": "edit", "id": pastes[0].Id, "text": "changed"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, other, "error")
+
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "edit", "id": pastes[0].Id, "text": "https://staging.example.org"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, other, "edit")
+	if paste, _ := ev["paste"].(map[string]interface{}); paste == nil || paste["Content"] != "https://staging.example.org" || paste["Version"] != float64(2) {
+		t.Errorf("Expected edit to be broadcast, got %v", ev)
+	}
+	if err := wsjson.Write(ctx, other, map[string]any{"action": "list"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	if pastes := readPastes(t, ctx, other); len(pastes) != 1 || pastes[0].Content != "https://staging.example.org" {
+		t.Errorf("Expected edited paste list, got %v", pastes)
+	}
+
+	// Pastes of other networks cannot be edited
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "BRAVE-OTTER", Content: "not yours", CreatedAt: time.Now()})
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "edit", "id": id, "text": "changed"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, author, "error")
+	if paste, _ := pts.dbm.GetPaste(id); paste.Content != "not yours" {
+		t.Errorf("Expected paste of another network to be unchanged, got %v", paste.Content)
+	}
+}
+
+func TestEditPolicyDevice(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	author, cookie := dialDevice(t, ctx, s.URL, "BRAVE-OTTER", nil)
+	readPastes(t, ctx, author)
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "add", "text": "first"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	pastes := readPastes(t, ctx, author)
+	author.CloseNow()
+
+	// Taking the author's name on the same browser does not make another device the author
+	impostor, _ := dialDevice(t, ctx, s.URL, "BRAVE-OTTER", nil)
+	defer impostor.CloseNow()
+	readPastes(t, ctx, impostor)
+	if err := wsjson.Write(ctx, impostor, map[string]any{"action": "edit", "id": pastes[0].Id, "text": "changed"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, impostor, "error")
+
+	author, _ = dialDevice(t, ctx, s.URL, "CALM-HERON", cookie)
+	defer author.CloseNow()
+	readPastes(t, ctx, author)
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "edit", "id": pastes[0].Id, "text": "second"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, author, "edit")
+
+	// Pastes made over the API have no author to edit them
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", User: "CALM-HERON", Content: "from a script", CreatedAt: time.Now()})
+	if err := wsjson.Write(ctx, author, map[string]any{"action": "edit", "id": id, "text": "changed"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	readEvent(t, ctx, author, "error")
+}
+
+func TestEditPolicyAnyone(t *testing.T) {
+	t.Setenv("EDIT_POLICY", "anyone")
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	s := httptest.NewServer(server.Handler)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c := dialEvents(t, ctx, s.URL, "CALM-HERON")
+	defer c.CloseNow()
+	readPastes(t, ctx, c)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "127.0.0.1", User: "BRAVE-OTTER", Content: "first", CreatedAt: time.Now()})
+	if err := wsjson.Write(ctx, c, map[string]any{"action": "edit", "id": id, "text": "second"}); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	ev := readEvent(t, ctx, c, "edit")
+	if paste, _ := ev["paste"].(map[string]interface{}); paste == nil || paste["EditedBy"] != "CALM-HERON" {
+		t.Errorf("Expected paste to be edited by anyone, got %v", ev)
+	}
+}
+
+func TestEditPolicyInvalid(t *testing.T) {
+	t.Setenv("EDIT_POLICY", "nobody")
+	if _, err := newEditPolicy(); err == nil {
+		t.Errorf("Expected invalid EDIT_POLICY to be refused")
+	}
+}
+
+func TestVersionsEndpoints(t *testing.T) {
+	server, pts := setupTest(t)
+	defer teardownTest(server)
+
+	id, _ := pts.dbm.InsertPaste(data.Paste{Network: "192.0.2.1", User: "BRAVE-OTTER", Content: "host=db\nport=5432\nuser=app", CreatedAt: time.Now()})
+	pts.dbm.EditPaste(id, data.Paste{Network: "192.0.2.1", User: "BRAVE-OTTER", Content: "host=db\nport=6432\nuser=app", CreatedAt: time.Now()})
+	pts.dbm.EditPaste(id, data.Paste{Network: "192.0.2.1", User: "BRAVE-OTTER", Content: "Tr0ub4dor&3", CreatedAt: time.Now()})
+	other, _ := pts.dbm.InsertPaste(data.Paste{Network: "198.51.100.1", Content: "not yours", CreatedAt: time.Now()})
+
+	w := authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/pastes/%d/versions", id), "", nil)
+	var versions []data.Version
+	json.NewDecoder(w.Body).Decode(&versions)
+	if w.Code != http.StatusOK || len(versions) != 3 || versions[2].Content != maskedContent {
+		t.Errorf("Expected 3 versions with the secret masked, got %v %v", w.Code, versions)
+	}
+
+	w = authRequest(server.Handler, http.MethodGet, fmt.Sprintf("/api/pastes/%d/diff?from=1&to=2", id), "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "-port=5432\n+port=6432\n") {
+		t.Errorf("Expected diff of versions 1 and 2, got %v %v", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{fmt.Sprintf("/api/pastes/%d/diff", id), http.StatusForbidden},
+		{fmt.Sprintf("/api/pastes/%d/diff?from=0&to=2", id), http.StatusBadRequest},
+		{fmt.Sprintf("/api/pastes/%d/diff?to=4", id), http.StatusBadRequest},
+		{fmt.Sprintf("/api/pastes/%d/versions", other), http.StatusNotFound},
+		{fmt.Sprintf("/api/pastes/%d/diff", other), http.StatusNotFound},
+		{"/api/pastes/abc/versions", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := authRequest(server.Handler, http.MethodGet, tt.path, "", nil); w.Code != tt.code {
+			t.Errorf("GET %v returned %v, expected %v", tt.path, w.Code, tt.code)
+		}
+	}
+}
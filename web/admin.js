@@ -0,0 +1,113 @@
+;(() => {
+    const { createApp } = Vue
+    createApp({
+      data(){
+        return {
+          token: sessionStorage.getItem('adminToken') || '',
+          tokenInput: '',
+          error: '',
+          networks: [],
+          clients: [],
+          bans: [],
+          errors: [],
+          selectedNetwork: '',
+          pastes: [],
+          newBan: {cidr: '', reason: '', minutes: 0}
+        }
+      },
+      methods: {
+        api(method, path, body) {
+          const opts = {method: method, headers: {'Authorization': `Bearer ${this.token}`}};
+          if (body !== undefined) {
+            opts.body = JSON.stringify(body);
+          }
+
+          return fetch(`/admin/api/${path}`, opts)
+            .then((response) => {
+              if (response.status === 401) {
+                this.signOut();
+                throw new Error('Invalid admin token');
+              }
+              if (!response.ok) {
+                return response.text().then((text) => { throw new Error(text); });
+              }
+              if (response.status === 204) {
+                return null;
+              }
+              return response.json();
+            })
+            .catch((error) => {
+              this.error = error.message;
+            });
+        },
+        saveToken() {
+          this.token = this.tokenInput;
+          sessionStorage.setItem('adminToken', this.token);
+          this.refresh();
+        },
+        signOut() {
+          this.token = '';
+          sessionStorage.removeItem('adminToken');
+        },
+        refresh() {
+          this.error = '';
+          this.api('GET', 'networks').then((data) => { this.networks = data || []; });
+          this.api('GET', 'clients').then((data) => { this.clients = data || []; });
+          this.api('GET', 'bans').then((data) => { this.bans = data || []; });
+          this.api('GET', 'errors').then((data) => { this.errors = data || []; });
+          if (this.selectedNetwork) {
+            this.showPastes(this.selectedNetwork);
+          }
+        },
+        showPastes(network) {
+          this.selectedNetwork = network;
+          this.api('GET', `networks/${encodeURIComponent(network)}/pastes`).then((data) => { this.pastes = data || []; });
+        },
+        purge(network) {
+          if (window.confirm(`Delete every paste on ${network}?`)) {
+            this.api('DELETE', `networks/${encodeURIComponent(network)}`).then(this.refresh);
+          }
+        },
+        deletePaste(id) {
+          this.api('DELETE', `pastes/${id}`).then(this.refresh);
+        },
+        ban(cidr) {
+          this.newBan.cidr = cidr;
+        },
+        addBan() {
+          this.api('POST', 'bans', this.newBan).then(() => {
+            this.newBan = {cidr: '', reason: '', minutes: 0};
+            this.refresh();
+          });
+        },
+        unban(id) {
+          this.api('DELETE', `bans/${id}`).then(this.refresh);
+        },
+        backup() {
+          // The backup is fetched with the token and handed to the browser as a download
+          fetch('/admin/api/backup', {headers: {'Authorization': `Bearer ${this.token}`}})
+            .then((response) => {
+              if (!response.ok) {
+                return response.text().then((text) => { throw new Error(text); });
+              }
+              const name = /filename="(.+)"/.exec(response.headers.get('Content-Disposition'));
+              return response.blob().then((blob) => {
+                const link = document.createElement('a');
+                link.href = URL.createObjectURL(blob);
+                link.download = name ? name[1] : 'pastytext.db';
+                link.click();
+                URL.revokeObjectURL(link.href);
+              });
+            })
+            .catch((error) => {
+              this.error = error.message;
+            });
+        }
+      },
+      mounted(){
+        if (this.token) {
+          this.refresh();
+        }
+      }
+    }).mount('#app')
+  })()
@@ -1,5 +1,18 @@
 ;(() => {
-    const { createApp } = Vue
+    const { createApp, markRaw } = Vue
+
+    // End-to-end encryption parameters, shared with the Go e2e package
+    const e2eScheme = 'e2e-v1';
+    const e2eSaltSize = 16;
+    const e2eIterations = 600000;
+    // Keys for at most e2eMaxSaltedKeys other salts are kept, and new ones are derived at
+    // most e2eSaltsPerSecond on average, so that pastes with many salts cannot stall the page
+    const e2eMaxSaltedKeys = 8;
+    const e2eSaltsPerSecond = 1;
+
+    // Image types the server accepts from the clipboard
+    const clipboardImageTypes = ['image/png', 'image/jpeg', 'image/webp'];
+
     createApp({
       data(){
         return {
@@ -8,11 +21,27 @@
           network: '',
           lastPasteTime: 0,
           pastes: '',
+          presence: [],
+          access: {enabled: false, protected: false, authenticated: false},
+          e2eKey: null,
+          revealed: {},
+          oneTime: false,
+          publishAt: '',
+          scheduled: [],
+          deletedBy: '',
+          undoId: 0,
+          pendingBulk: null,
+          tagFilter: '',
+          collections: [],
+          collectionFilter: 0,
+          quickReactions: ['\u{1F44D}', '\u{2764}\u{FE0F}', '\u{1F602}', '\u{1F389}', '\u{1F440}'],
+          errorMessage: '',
           now: Date.now(),
           showNewBanner: false,
           showDeleteBanner: false,
           showCopyBanner: false,
-          showDelayBanner: false
+          showDelayBanner: false,
+          showErrorBanner: false
         }
       },
       computed:{
@@ -24,7 +53,14 @@
             return [];
           }
 
-          Array.from(this.pastes).forEach(function(element) {
+          Array.from(this.pastes).forEach((element) => {
+            if (this.tagFilter && !(element.Tags || []).includes(this.tagFilter)) {
+              return;
+            }
+            if (this.collectionFilter && element.CollectionId !== this.collectionFilter) {
+              return;
+            }
+
             if (element.Id > latestPasteIdx) {
               element.isNew = true;
             } else {
@@ -36,15 +72,41 @@
           });
 
           if (cleanedPastes.length > 0) {
-            localStorage.setItem("latestPasteIdx", cleanedPastes[0]["Id"]);
+            // Pinned pastes are listed first, so the newest paste is not always the first one
+            localStorage.setItem("latestPasteIdx", Math.max(...cleanedPastes.map((p) => p.Id)));
           }
           
           return cleanedPastes;
+        },
+        collectionCounts(){
+          const counts = {};
+          for (const paste of Array.from(this.pastes || [])) {
+            if (paste.CollectionId) {
+              counts[paste.CollectionId] = (counts[paste.CollectionId] || 0) + 1;
+            }
+          }
+          return counts;
+        },
+        selectedCollection(){
+          return this.collections.find((c) => c.Id === this.collectionFilter);
+        },
+        tagCounts(){
+          // Counted from the pastes the server sent, the same ones GET /api/tags counts
+          const counts = {};
+          for (const paste of Array.from(this.pastes || [])) {
+            for (const tag of paste.Tags || []) {
+              counts[tag] = (counts[tag] || 0) + 1;
+            }
+          }
+          return Object.entries(counts)
+            .map(([tag, count]) => ({Tag: tag, Count: count}))
+            .sort((a, b) => b.Count - a.Count || a.Tag.localeCompare(b.Tag));
         }
       },
       methods: {
         dial() {
-          this.conn = new WebSocket(`wss://${location.host}/ws`, `pastytextProtocol`);
+          const query = new URLSearchParams({"events": "1", "name": this.identity});
+          this.conn = new WebSocket(`wss://${location.host}/ws?${query}`, `pastytextProtocol`);
       
           this.conn.addEventListener('close', ev => {
             console.log(`WebSocket Disconnected code: ${ev.code}, reason: ${ev.reason}`, true);
@@ -65,7 +127,49 @@
               return;
             }
     
-            this.pastes = JSON.parse(ev.data);
+            const msg = JSON.parse(ev.data);
+            if (msg !== null && !Array.isArray(msg)) {
+              this.handleEvent(msg);
+              return;
+            }
+
+            this.decryptPastes(msg).then(this.receivePastes);
+          })
+    
+          window.addEventListener('paste', this.handlePaste);
+        },
+        uploadFiles(files) {
+          for (const file of files) {
+            const form = new FormData();
+            form.append('file', file);
+            form.append('user', this.identity);
+            fetch('/api/attachments', {method: 'POST', body: form})
+              .then((response) => {
+                if (!response.ok) {
+                  return response.text().then((text) => this.showError(text.trim()));
+                }
+              })
+              .catch((error) => this.showError(error.message));
+          }
+        },
+        handleDrop(ev) {
+          if (ev.dataTransfer && ev.dataTransfer.files.length > 0) {
+            ev.preventDefault();
+            this.uploadFiles(ev.dataTransfer.files);
+          }
+        },
+        formatSize(bytes) {
+          const units = ['B', 'KB', 'MB', 'GB'];
+          let i = 0;
+          while (bytes >= 1024 && i < units.length - 1) {
+            bytes /= 1024;
+            i++;
+          }
+          return `${i === 0 ? bytes : bytes.toFixed(1)} ${units[i]}`;
+        },
+        receivePastes(pastes) {
+            this.pastes = pastes;
+            this.applyRevealed();
             if (this.pastes === null || this.pastes.length === 0) {
               console.log('no pastes');
               localStorage.removeItem("latestPasteIdx");
@@ -80,11 +184,298 @@
                 this.showDelayBanner = false;
               }
             }
-          })
-    
-          window.addEventListener('paste', this.handlePaste);
         },
-        handlePaste(){
+        async deriveKey(secret, salt) {
+          const base = await crypto.subtle.importKey('raw', new TextEncoder().encode(secret), 'PBKDF2', false, ['deriveKey']);
+          return crypto.subtle.deriveKey(
+            {name: 'PBKDF2', hash: 'SHA-256', salt: salt, iterations: e2eIterations},
+            base, {name: 'AES-GCM', length: 256}, false, ['encrypt', 'decrypt']);
+        },
+        // roomKey derives the key sealing new pastes with a random salt. Keys for the
+        // salts of pastes sealed elsewhere are derived when they are first opened.
+        async roomKey(secret) {
+          const salt = crypto.getRandomValues(new Uint8Array(e2eSaltSize));
+          const key = await this.deriveKey(secret, salt);
+          const b64 = btoa(String.fromCharCode(...salt));
+          return markRaw({secret: secret, salt: salt, b64: b64, key: key, salted: new Map(), tokens: e2eMaxSaltedKeys, last: Date.now()});
+        },
+        saltedKey(b64) {
+          const room = this.e2eKey;
+          if (b64 === room.b64) {
+            return room.key;
+          }
+
+          // The map keeps the most recently used key last
+          let key = room.salted.get(b64);
+          if (key === undefined) {
+            const now = Date.now();
+            room.tokens = Math.min(e2eMaxSaltedKeys, room.tokens + (now - room.last) / 1000 * e2eSaltsPerSecond);
+            room.last = now;
+            if (room.tokens < 1) {
+              return Promise.reject(new Error('too many pastes with new salts'));
+            }
+            room.tokens--;
+            key = this.deriveKey(room.secret, Uint8Array.from(atob(b64), c => c.charCodeAt(0)));
+          }
+          room.salted.delete(b64);
+          room.salted.set(b64, key);
+          if (room.salted.size > e2eMaxSaltedKeys) {
+            room.salted.delete(room.salted.keys().next().value);
+          }
+          return key;
+        },
+        async setRoomSecret() {
+          const secret = window.prompt("Enter the room secret to encrypt pastes end-to-end. Leave empty to turn encryption off.", "");
+          if (secret === null) {
+            return;
+          }
+
+          if (secret === '') {
+            this.e2eKey = null;
+            localStorage.removeItem('roomSecret');
+          } else {
+            this.e2eKey = await this.roomKey(secret);
+            localStorage.setItem('roomSecret', secret);
+          }
+
+          if (Array.isArray(this.pastes)) {
+            this.conn.send(JSON.stringify({"action": "list"}));
+          }
+        },
+        async encryptText(text) {
+          const iv = crypto.getRandomValues(new Uint8Array(12));
+          const ct = await crypto.subtle.encrypt({name: 'AES-GCM', iv: iv}, this.e2eKey.key, new TextEncoder().encode(text));
+          const b64 = (bytes) => btoa(String.fromCharCode(...new Uint8Array(bytes)));
+          return `v2:${b64(this.e2eKey.salt)}:${b64(iv)}:${b64(ct)}`;
+        },
+        async decryptText(envelope) {
+          const parts = envelope.split(':');
+          if (parts.length !== 4 || parts[0] !== 'v2') {
+            throw new Error('malformed envelope');
+          }
+          const bytes = (b64) => Uint8Array.from(atob(b64), c => c.charCodeAt(0));
+          const key = await this.saltedKey(parts[1]);
+          const pt = await crypto.subtle.decrypt({name: 'AES-GCM', iv: bytes(parts[2])}, key, bytes(parts[3]));
+          return new TextDecoder().decode(pt);
+        },
+        async decryptPastes(pastes) {
+          if (pastes === null) {
+            return pastes;
+          }
+
+          for (const paste of pastes) {
+            if (paste.Replies) {
+              await this.decryptPastes(paste.Replies);
+            }
+            // One-time pastes only carry a placeholder until they are consumed
+            if (paste.Encryption !== e2eScheme || paste.OneTime) {
+              continue;
+            }
+
+            paste.locked = true;
+            if (this.e2eKey === null) {
+              paste.Content = 'Encrypted paste, set the room secret to read it';
+              continue;
+            }
+
+            try {
+              paste.Content = await this.decryptText(paste.Content);
+              paste.locked = false;
+            } catch (error) {
+              paste.Content = 'Encrypted paste, the room secret does not match';
+            }
+          }
+          return pastes;
+        },
+        applyRevealed(pastes = this.pastes) {
+          if (!Array.isArray(pastes)) {
+            return;
+          }
+
+          // The server masks detected secrets, show the ones this device revealed
+          for (const paste of pastes) {
+            this.applyRevealed(paste.Replies);
+            if (!paste.Secret) {
+              continue;
+            }
+            const content = this.revealed[paste.Id];
+            paste.masked = content === undefined;
+            paste.locked = paste.masked;
+            if (!paste.masked) {
+              paste.Content = content;
+            }
+          }
+        },
+        consumePaste(id) {
+          this.conn.send(JSON.stringify({"action": "consume", "id": id}));
+        },
+        async receiveConsumed(paste) {
+          const [decrypted] = await this.decryptPastes([{...paste, OneTime: false}]);
+          try {
+            await navigator.clipboard.writeText(decrypted.Content);
+            this.showCopyBanner = true;
+            this.showDeleteBanner = false;
+            this.showNewBanner = false;
+            this.showDelayBanner = false;
+          } catch (error) {
+            // Copying outside of a click can be refused, the content is gone from the server so show it
+            window.prompt("One-time paste, copy it now:", decrypted.Content);
+          }
+        },
+        revealPaste(id) {
+          this.conn.send(JSON.stringify({"action": "reveal", "id": id}));
+        },
+        hidePaste(id) {
+          delete this.revealed[id];
+          this.conn.send(JSON.stringify({"action": "list"}));
+        },
+        handleEvent(ev) {
+          switch (ev.event) {
+            case 'presence':
+              this.presence = ev.clients;
+              this.setName(ev.client.name);
+              break;
+            case 'join':
+              this.presence = this.presence.filter(c => c.name !== ev.client.name).concat([ev.client]);
+              break;
+            case 'leave':
+              this.presence = this.presence.filter(c => c.name !== ev.client.name);
+              break;
+            case 'rename':
+              this.presence = this.presence.map(c => c.name === ev.old_name ? ev.client : c);
+              if (ev.old_name === this.identity) {
+                this.setName(ev.client.name);
+              }
+              break;
+            case 'consume':
+              this.receiveConsumed(ev.paste);
+              break;
+            case 'reveal':
+              this.revealed[ev.paste.Id] = ev.paste.Content;
+              this.applyRevealed();
+              break;
+            case 'delete':
+              if (ev.paste.DeletedBy !== this.identity) {
+                this.deletedBy = ev.paste.DeletedBy;
+                this.undoId = ev.paste.Id;
+                this.showDeleteBanner = true;
+              }
+              break;
+            case 'restore':
+              this.showDeleteBanner = false;
+              break;
+            case 'confirm':
+              // Bulk deletions are sent again with the token once the user agrees
+              if (this.pendingBulk && window.confirm(`Delete ${ev.count} pastes? Pinned pastes are kept.`)) {
+                this.conn.send(JSON.stringify({...this.pendingBulk, "confirm": ev.confirm}));
+              }
+              this.pendingBulk = null;
+              break;
+            case 'reply':
+              this.decryptPastes([ev.paste]).then(([reply]) => {
+                const parent = (this.pastes || []).find((p) => p.Id === reply.ParentId);
+                if (parent) {
+                  parent.Replies = (parent.Replies || []).concat([reply]);
+                  this.applyRevealed();
+                }
+              });
+              break;
+            case 'react':
+              for (const paste of this.pastes || []) {
+                for (const p of [paste].concat(paste.Replies || [])) {
+                  if (p.Id === ev.id) {
+                    p.Reactions = ev.reactions || [];
+                  }
+                }
+              }
+              break;
+            case 'scheduled':
+              this.decryptPastes(ev.scheduled || []).then((scheduled) => { this.scheduled = scheduled; });
+              break;
+            case 'collections':
+              this.collections = ev.collections || [];
+              if (!this.selectedCollection) {
+                this.collectionFilter = 0;
+              }
+              break;
+            case 'delete_many':
+              this.deletedBy = ev.by;
+              this.undoId = 0;
+              this.showDeleteBanner = true;
+              break;
+            case 'error':
+              this.showError(ev.message);
+              break;
+          }
+        },
+        checkAccess() {
+          return fetch('/auth')
+            .then((response) => response.json())
+            .then((status) => {
+              this.access = status;
+              if (status.protected && !status.authenticated) {
+                return this.login();
+              }
+            })
+            .catch((error) => {
+              console.error(error.message);
+            })
+        },
+        login() {
+          const passphrase = window.prompt("This network is protected, enter its passphrase");
+          if (passphrase === null) {
+            return;
+          }
+
+          return fetch('/auth', {method: 'POST', body: JSON.stringify({"passphrase": passphrase})})
+            .then((response) => {
+              if (response.ok) {
+                this.access.authenticated = true;
+                return;
+              }
+              return response.text().then((text) => {
+                window.alert(text);
+                if (response.status === 401) {
+                  return this.login();
+                }
+              });
+            });
+        },
+        protectNetwork() {
+          const passphrase = window.prompt("Choose a passphrase that devices on this network must enter");
+          if (!passphrase) {
+            return;
+          }
+
+          fetch('/auth/claim', {method: 'POST', body: JSON.stringify({"passphrase": passphrase})})
+            .then((response) => {
+              if (response.ok) {
+                this.access.protected = true;
+                this.access.authenticated = true;
+                return;
+              }
+              return response.text().then((text) => this.showError(text));
+            });
+        },
+        setName(name) {
+          this.identity = name;
+          localStorage.setItem("identity", name);
+        },
+        renameDevice() {
+          const name = window.prompt("Choose a name for this device", this.identity);
+          if (name && name !== this.identity) {
+            this.conn.send(JSON.stringify({"action": "rename", "text": name}));
+          }
+        },
+        showError(message) {
+          this.errorMessage = message;
+          this.showErrorBanner = true;
+          this.showCopyBanner = false;
+          this.showDeleteBanner = false;
+          this.showNewBanner = false;
+          this.showDelayBanner = false;
+        },
+        handlePaste(ev){
           // Prevent pasting if the last paste was less than 3 seconds ago
           if (((Date.now() - this.lastPasteTime) / 1000) < 3) {
             this.showDelayBanner = true;
@@ -93,6 +484,15 @@
 
           this.showDelayBanner = false;
 
+          // Screenshots and copied images arrive as files on the paste event
+          const items = ev && ev.clipboardData ? Array.from(ev.clipboardData.items) : [];
+          const image = items.find((item) => item.kind === 'file' && clipboardImageTypes.includes(item.type));
+          if (image) {
+            ev.preventDefault();
+            this.sendImage(image.getAsFile());
+            return;
+          }
+
           let pastedText = '';
           navigator.clipboard
             .readText()
@@ -102,12 +502,59 @@
               if (pastedText) {
                 const msg = {"user": this.identity,
                   "action": "add", 
-                  "text": pastedText};
-                this.conn.send(JSON.stringify(msg));
-                this.lastPasteTime = Date.now();
+                  "text": pastedText,
+                  "one_time": this.oneTime};
+                this.oneTime = false;
+                if (this.publishAt) {
+                  msg.publish_at = new Date(this.publishAt).toISOString();
+                  this.publishAt = '';
+                }
+
+                if (this.e2eKey === null) {
+                  this.conn.send(JSON.stringify(msg));
+                  this.lastPasteTime = Date.now();
+                  return;
+                }
+
+                this.encryptText(pastedText).then((envelope) => {
+                  msg.text = envelope;
+                  msg.encryption = e2eScheme;
+                  this.conn.send(JSON.stringify(msg));
+                  this.lastPasteTime = Date.now();
+                });
               }
             });
         },
+        sendImage(file) {
+          // Binary frames carry a JSON header line followed by the file
+          const header = JSON.stringify({"action": "image", "text": file.name === 'image.png' ? '' : file.name});
+          this.conn.send(new Blob([header + '\n', file]));
+          this.lastPasteTime = Date.now();
+        },
+        async copyImage(paste) {
+          try {
+            let blob = await fetch(`/api/attachments/${paste.Attachment.Id}`).then((response) => response.blob());
+            if (blob.type !== 'image/png') {
+              // Browsers only accept PNG images on the clipboard
+              const bitmap = await createImageBitmap(blob);
+              const canvas = document.createElement('canvas');
+              canvas.width = bitmap.width;
+              canvas.height = bitmap.height;
+              canvas.getContext('2d').drawImage(bitmap, 0, 0);
+              blob = await new Promise((resolve) => canvas.toBlob(resolve, 'image/png'));
+            }
+            await navigator.clipboard.write([new ClipboardItem({'image/png': blob})]);
+            this.$refs['copy_' + paste.Id][0].textContent = "Copied!";
+            paste.isShown = false;
+
+            this.showCopyBanner = true;
+            this.showDeleteBanner = false;
+            this.showNewBanner = false;
+            this.showDelayBanner = false;
+          } catch (error) {
+            this.showError(`Could not copy the image: ${error.message}`);
+          }
+        },
         setIdentity() {
           if (localStorage.getItem('ipaddress')) {
             this.network = localStorage.getItem('ipaddress');
@@ -117,7 +564,7 @@
               this.identity = localStorage.getItem('identity');
           }
   
-          fetch('/id')
+          return fetch('/id')
             .then((response) => response.json())
             .then((data) => {
 
@@ -134,49 +581,112 @@
                 console.error(error.message);
             })
         },
+        undoDelete() {
+          // Deleted pastes stay in the trash for a while and can be restored
+          this.conn.send(JSON.stringify({"action": "restore", "id": this.undoId}));
+          this.showDeleteBanner = false;
+        },
+        bulkDelete(msg) {
+          this.pendingBulk = msg;
+          this.conn.send(JSON.stringify(msg));
+        },
+        pinPaste(paste) {
+          this.conn.send(JSON.stringify({"action": paste.Pinned ? "unpin" : "pin", "id": paste.Id}));
+        },
+        tagPaste(paste) {
+          const text = window.prompt('Tags, separated by spaces. Hashtags in the paste are always tags.', (paste.Tags || []).map((t) => '#' + t).join(' '));
+          if (text === null) {
+            return;
+          }
+          this.conn.send(JSON.stringify({"action": "tag", "id": paste.Id, "tags": text.split(/[\s,]+/).filter((t) => t.replace('#', ''))}));
+        },
+        replyPaste(paste) {
+          const text = window.prompt('Reply');
+          if (!text) {
+            return;
+          }
+
+          const msg = {"user": this.identity, "action": "add", "text": text, "parent_id": paste.Id};
+          if (this.e2eKey === null) {
+            this.conn.send(JSON.stringify(msg));
+            return;
+          }
+          this.encryptText(text).then((envelope) => {
+            msg.text = envelope;
+            msg.encryption = e2eScheme;
+            this.conn.send(JSON.stringify(msg));
+          });
+        },
+        reactPaste(paste, emoji) {
+          this.conn.send(JSON.stringify({"action": "react", "id": paste.Id, "emoji": emoji}));
+        },
+        reacted(reaction) {
+          return reaction.Users.includes(this.identity);
+        },
+        cancelScheduled(id) {
+          this.conn.send(JSON.stringify({"action": "cancel", "id": id}));
+        },
+        createCollection() {
+          const name = window.prompt('Name of the new collection');
+          if (name) {
+            this.conn.send(JSON.stringify({"action": "create_collection", "text": name}));
+          }
+        },
+        renameCollection(collection) {
+          const name = window.prompt('Rename the collection', collection.Name);
+          if (name && name !== collection.Name) {
+            this.conn.send(JSON.stringify({"action": "rename_collection", "id": collection.Id, "text": name}));
+          }
+        },
+        deleteCollection(collection) {
+          if (window.confirm(`Delete the collection ${collection.Name}? Its pastes are kept.`)) {
+            this.conn.send(JSON.stringify({"action": "delete_collection", "id": collection.Id}));
+          }
+        },
+        movePaste(paste, collectionId) {
+          this.conn.send(JSON.stringify({"action": "move", "id": paste.Id, "collection_id": collectionId}));
+        },
+        filterCollection(id) {
+          this.collectionFilter = this.collectionFilter === id ? 0 : id;
+        },
+        filterTag(tag) {
+          this.tagFilter = this.tagFilter === tag ? '' : tag;
+        },
+        editPaste(paste) {
+          const text = window.prompt('Edit paste', paste.Content);
+          if (text === null || text === paste.Content) {
+            return;
+          }
+
+          const msg = {"action": "edit", "id": paste.Id, "text": text};
+          if (this.e2eKey === null || !paste.Encryption) {
+            this.conn.send(JSON.stringify(msg));
+            return;
+          }
+          this.encryptText(text).then((envelope) => {
+            msg.text = envelope;
+            msg.encryption = e2eScheme;
+            this.conn.send(JSON.stringify(msg));
+          });
+        },
         deletePaste(pasteID) {
           const msg = {"action": "delete", 
             "id": pasteID};
           this.conn.send(JSON.stringify(msg));
+          this.deletedBy = this.identity;
+          this.undoId = pasteID;
 
           this.showDeleteBanner = true;
           this.showCopyBanner = false;
           this.showNewBanner = false;
           this.showDelayBanner = false;
         },
-        isPassword(text) {
-          // Check if the text has at least 8 characters
-          if (text.length < 8) {
-              return false;
-          }
-
-          // // Check if the text contains any spaces
-          if (/\s/.test(text)) {
-            return false;
-          }
-      
-          // Check if the text contains at least one lowercase letter
-          if (!/[a-z]/.test(text)) {
-              return false;
-          }
-      
-          // Check if the text contains at least one uppercase letter
-          if (!/[A-Z]/.test(text)) {
-              return false;
-          }
-      
-          // Check if the text contains at least one digit
-          if (!/\d/.test(text)) {
-              return false;
-          }
-      
-          // Check if the text contains at least one special character
-          if (!/[!@#$%^&*(),.?":{}|<>]/.test(text)) {
-              return false;
-          }
-      
-          // If all conditions are met, the text is a valid password
-          return true;
+      isLink(paste) {
+        // The server classifies plain text pastes, only decrypted pastes are checked here
+        if (paste.Type) {
+          return paste.Type === 'url';
+        }
+        return !paste.locked && this.isURL(paste.Content);
       },
       isURL(text) {
         // Regular expression to check if the text matches a URL pattern with or without a protocol
@@ -258,11 +768,19 @@
     },
     hideDelayBanner() {
       this.showDelayBanner = false;
+    },
+    hideErrorBanner() {
+      this.showErrorBanner = false;
     }
       },
       mounted(){
-        this.setIdentity();
-        this.dial();
+        const secret = localStorage.getItem('roomSecret');
+        const key = secret ? this.roomKey(secret).then((key) => { this.e2eKey = key; }) : null;
+        Promise.all([this.setIdentity(), this.checkAccess(), key]).finally(this.dial);
+
+        // Files dropped anywhere on the page are shared
+        window.addEventListener('dragover', (ev) => ev.preventDefault());
+        window.addEventListener('drop', this.handleDrop);
       }
 
     }).mount('#app')